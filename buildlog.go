@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// BuildLog ...
+type BuildLog struct {
+	ExpiringRawLogURL string `json:"expiring_raw_log_url"`
+	IsArchived        bool   `json:"is_archived"`
+}
+
+// GetBuildLog returns the log info of the build, holding the expiring url of its raw log once archived
+func (c Client) GetBuildLog(appSlug, buildSlug string) (BuildLog, error) {
+	return c.GetBuildLogCtx(context.Background(), appSlug, buildSlug)
+}
+
+// GetBuildLogCtx is GetBuildLog with a cancellable context
+func (c Client) GetBuildLogCtx(ctx context.Context, appSlug, buildSlug string) (buildLog BuildLog, err error) {
+	requestPath := fmt.Sprintf("apps/%s/builds/%s/log", appSlug, buildSlug)
+
+	resp, err := c.get(ctx, requestPath)
+	if err != nil {
+		return
+	}
+	defer responseBodyCloser(resp)
+
+	if resp.StatusCode >= 300 || resp.StatusCode < 200 {
+		err = &APIError{Operation: "get build log", StatusCode: resp.StatusCode, Endpoint: requestPath, AppSlug: appSlug, BuildSlug: buildSlug, Body: readBodySnippet(resp)}
+		return
+	}
+
+	err = decodeJSON(resp, requestPath, &buildLog)
+	return
+}
+
+// DownloadBuildLog returns the raw log of the build, the caller must close it, even when reading it fails.
+// The log is only available once the build finished and its log was archived.
+func (c Client) DownloadBuildLog(appSlug, buildSlug string) (io.ReadCloser, error) {
+	return c.DownloadBuildLogCtx(context.Background(), appSlug, buildSlug)
+}
+
+// DownloadBuildLogCtx is DownloadBuildLog with a cancellable context
+func (c Client) DownloadBuildLogCtx(ctx context.Context, appSlug, buildSlug string) (io.ReadCloser, error) {
+	buildLog, err := c.GetBuildLogCtx(ctx, appSlug, buildSlug)
+	if err != nil {
+		return nil, err
+	}
+	if buildLog.ExpiringRawLogURL == "" {
+		return nil, fmt.Errorf("log of the build (%s) is not available, the build is still running or its log is not archived yet", buildSlug)
+	}
+
+	resp, err := c.openURL(ctx, http.MethodGet, buildLog.ExpiringRawLogURL, 0, "")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 || resp.StatusCode < 200 {
+		responseBodyCloser(resp)
+		return nil, fmt.Errorf("failed to download the log of the build (%s) with status code (%d)", buildSlug, resp.StatusCode)
+	}
+
+	return resp.Body, nil
+}
+
+// buildLogFileName name of the downloaded build log file
+func buildLogFileName(buildSlug string) (string, error) {
+	name, err := sanitizeFileName(buildSlug)
+	if err != nil {
+		return "", err
+	}
+	return "build-" + name + ".log", nil
+}
+
+// downloadBuildLog writes the log of the build into the download directory, returning the path of the file
+func (d downloader) downloadBuildLog(ctx context.Context) (path string, err error) {
+	fileName, err := buildLogFileName(d.buildSlug)
+	if err != nil {
+		return "", err
+	}
+	path = filepath.Join(d.downloadDir, fileName)
+
+	body, err := d.client.DownloadBuildLogCtx(ctx, d.appSlug, d.buildSlug)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if err := body.Close(); err != nil {
+			warnf("Failed to close response body: %+v", err)
+		}
+	}()
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, d.fileMode)
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(file, body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		removeFile(path)
+		return "", fmt.Errorf("failed to download the log of the build (%s): %w", d.buildSlug, err)
+	}
+
+	infof("build log downloaded to (%s)", path)
+	return path, nil
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sync"
+)
+
+// buildStatusSuccess status of the successfully finished builds
+const buildStatusSuccess = 1
+
+// latestBuildsConcurrency maximum number of parallel artifacts listings of GetArtifactsForLatestBuilds
+const latestBuildsConcurrency = 4
+
+// BuildListItem ...
+type BuildListItem struct {
+	Slug              string `json:"slug"`
+	Status            int    `json:"status"`
+	StatusText        string `json:"status_text"`
+	Branch            string `json:"branch"`
+	BuildNumber       int    `json:"build_number"`
+	TriggeredAt       string `json:"triggered_at"`
+	TriggeredWorkflow string `json:"triggered_workflow"`
+}
+
+// Builds ...
+type Builds struct {
+	Data   []BuildListItem `json:"data"`
+	Paging Paging          `json:"paging"`
+}
+
+// Build details of a build
+type Build struct {
+	Slug              string `json:"slug"`
+	Status            int    `json:"status"`
+	StatusText        string `json:"status_text"`
+	Branch            string `json:"branch"`
+	BuildNumber       int    `json:"build_number"`
+	CommitHash        string `json:"commit_hash"`
+	TriggeredAt       string `json:"triggered_at"`
+	TriggeredWorkflow string `json:"triggered_workflow"`
+}
+
+// buildResponse body of the build endpoint
+type buildResponse struct {
+	Data Build `json:"data"`
+}
+
+// GetBuild returns the details of the build, like its number and commit hash
+func (c Client) GetBuild(appSlug, buildSlug string) (Build, error) {
+	return c.GetBuildCtx(context.Background(), appSlug, buildSlug)
+}
+
+// GetBuildCtx is GetBuild with a cancellable context
+func (c Client) GetBuildCtx(ctx context.Context, appSlug, buildSlug string) (build Build, err error) {
+	requestPath := fmt.Sprintf("apps/%s/builds/%s", appSlug, buildSlug)
+
+	resp, err := c.get(ctx, requestPath)
+	if err != nil {
+		return
+	}
+	defer responseBodyCloser(resp)
+
+	if resp.StatusCode >= 300 || resp.StatusCode < 200 {
+		err = &APIError{Operation: "get build", StatusCode: resp.StatusCode, Endpoint: requestPath, AppSlug: appSlug, BuildSlug: buildSlug, Body: readBodySnippet(resp)}
+		return
+	}
+
+	var body buildResponse
+	if err = decodeJSON(resp, requestPath, &body); err != nil {
+		return
+	}
+	build = body.Data
+	return
+}
+
+// GetLatestSuccessfulBuild returns the newest successful build of the app, on the given branch when not empty
+func (c Client) GetLatestSuccessfulBuild(appSlug, branch string) (BuildListItem, error) {
+	return c.GetLatestSuccessfulBuildCtx(context.Background(), appSlug, branch)
+}
+
+// GetLatestSuccessfulBuildCtx is GetLatestSuccessfulBuild with a cancellable context
+func (c Client) GetLatestSuccessfulBuildCtx(ctx context.Context, appSlug, branch string) (BuildListItem, error) {
+	query := url.Values{}
+	query.Set("status", fmt.Sprint(buildStatusSuccess))
+	query.Set("sort_by", "created_at")
+	query.Set("limit", "1")
+	if branch != "" {
+		query.Set("branch", branch)
+	}
+	builds, err := c.getBuildsPage(ctx, appSlug, query)
+	if err != nil {
+		return BuildListItem{}, err
+	}
+
+	if len(builds.Data) == 0 {
+		return BuildListItem{}, sentinelError{
+			message:  fmt.Sprintf("no successful build found for [app_slug: %s, branch: %s]", appSlug, branch),
+			sentinel: ErrBuildNotFound,
+		}
+	}
+	return builds.Data[0], nil
+}
+
+func (c Client) getBuildsPage(ctx context.Context, appSlug string, query url.Values) (builds Builds, err error) {
+	requestPath := fmt.Sprintf("apps/%s/builds?%s", appSlug, query.Encode())
+
+	resp, err := c.get(ctx, requestPath)
+	if err != nil {
+		return
+	}
+	defer responseBodyCloser(resp)
+
+	if resp.StatusCode >= 300 || resp.StatusCode < 200 {
+		err = &APIError{Operation: "get builds", StatusCode: resp.StatusCode, Endpoint: requestPath, AppSlug: appSlug, Body: readBodySnippet(resp)}
+		return
+	}
+
+	err = decodeJSON(resp, requestPath, &builds)
+	return
+}
+
+// BuildArtifacts artifacts of a build
+type BuildArtifacts struct {
+	Build     BuildListItem `json:"build"`
+	Artifacts Artifacts     `json:"artifacts"`
+}
+
+// GetArtifactsForLatestBuilds returns the artifacts of the n most recent builds of the app, whatever their status,
+// newest first. The artifacts of up to latestBuildsConcurrency builds are fetched in parallel, the first error
+// cancels the other fetches and is returned.
+func (c Client) GetArtifactsForLatestBuilds(appSlug string, n int) ([]BuildArtifacts, error) {
+	return c.GetArtifactsForLatestBuildsCtx(context.Background(), appSlug, n)
+}
+
+// GetArtifactsForLatestBuildsCtx is GetArtifactsForLatestBuilds with a cancellable context
+func (c Client) GetArtifactsForLatestBuildsCtx(ctx context.Context, appSlug string, n int) ([]BuildArtifacts, error) {
+	builds, err := c.getLatestBuilds(ctx, appSlug, n)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	results := make([]BuildArtifacts, len(builds))
+	semaphore := make(chan struct{}, latestBuildsConcurrency)
+	for i, build := range builds {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(i int, build BuildListItem) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+
+			artifacts, err := c.GetArtifactsForBuildCtx(ctx, appSlug, build.Slug)
+			if err != nil {
+				once.Do(func() {
+					firstErr = fmt.Errorf("failed to get the artifacts of build (%s): %w", build.Slug, err)
+					cancel()
+				})
+				return
+			}
+			results[i] = BuildArtifacts{Build: build, Artifacts: artifacts}
+		}(i, build)
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return results, nil
+}
+
+// getLatestBuilds returns up to n most recent builds of the app, following the paging cursor
+func (c Client) getLatestBuilds(ctx context.Context, appSlug string, n int) ([]BuildListItem, error) {
+	query := url.Values{}
+	query.Set("sort_by", "created_at")
+	return c.getBuilds(ctx, appSlug, query, n)
+}
+
+// getBuilds returns up to n builds of the app selected by the query, following the paging cursor
+func (c Client) getBuilds(ctx context.Context, appSlug string, query url.Values, n int) ([]BuildListItem, error) {
+	var builds []BuildListItem
+	query.Set("limit", fmt.Sprint(n))
+	seen := map[string]bool{}
+	for len(builds) < n {
+		page, err := c.getBuildsPage(ctx, appSlug, query)
+		if err != nil {
+			return nil, err
+		}
+
+		builds = append(builds, page.Data...)
+		if page.Paging.Next == "" {
+			break
+		}
+		if err := checkNextPage(fmt.Sprintf("builds of app (%s)", appSlug), seen, page.Paging.Next, len(page.Data)); err != nil {
+			return nil, err
+		}
+		query.Set("next", page.Paging.Next)
+	}
+
+	if len(builds) > n {
+		builds = builds[:n]
+	}
+	return builds, nil
+}
+
+// FindNewestBuildWithArtifact returns the newest of the maxBuilds latest successful builds of the app, on the branch
+// when not empty, having an artifact matching the name, which can be a glob pattern, along with its artifacts.
+// The builds are scanned newest first, an ErrArtifactNotFound error is returned when none matches.
+func (c Client) FindNewestBuildWithArtifact(appSlug, branch, name string, maxBuilds int) (BuildArtifacts, error) {
+	return c.FindNewestBuildWithArtifactCtx(context.Background(), appSlug, branch, name, maxBuilds)
+}
+
+// FindNewestBuildWithArtifactCtx is FindNewestBuildWithArtifact with a cancellable context
+func (c Client) FindNewestBuildWithArtifactCtx(ctx context.Context, appSlug, branch, name string, maxBuilds int) (BuildArtifacts, error) {
+	hasMatch := func(artifacts Artifacts) bool {
+		matches, err := matchName(artifacts.Data, name, artifactFilter{})
+		return err == nil && len(matches) > 0
+	}
+	return c.findNewestBuild(ctx, appSlug, branch, fmt.Sprintf("(%s)", name), maxBuilds, hasMatch)
+}
+
+// findNewestBuild scans the maxBuilds latest successful builds newest first, returning the first one
+// whose artifacts match, described by what in the not found error
+func (c Client) findNewestBuild(ctx context.Context, appSlug, branch, what string, maxBuilds int, match func(Artifacts) bool) (BuildArtifacts, error) {
+	query := url.Values{}
+	query.Set("status", fmt.Sprint(buildStatusSuccess))
+	query.Set("sort_by", "created_at")
+	if branch != "" {
+		query.Set("branch", branch)
+	}
+	builds, err := c.getBuilds(ctx, appSlug, query, maxBuilds)
+	if err != nil {
+		return BuildArtifacts{}, err
+	}
+
+	for _, build := range builds {
+		artifacts, err := c.GetArtifactsForBuildCtx(ctx, appSlug, build.Slug)
+		if err != nil {
+			return BuildArtifacts{}, err
+		}
+		if match(artifacts) {
+			return BuildArtifacts{Build: build, Artifacts: artifacts}, nil
+		}
+		debugf("build #%d (%s) has no matching artifact", build.BuildNumber, build.Slug)
+	}
+
+	return BuildArtifacts{}, sentinelError{
+		message:  fmt.Sprintf("no artifact matching %s in the %d latest successful builds of [app_slug: %s, branch: %s]", what, len(builds), appSlug, branch),
+		sentinel: ErrArtifactNotFound,
+	}
+}
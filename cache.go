@@ -0,0 +1,77 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const cacheDirName = "bitrise-step-artefact-download"
+
+// listingCache on-disk copy of an artifacts listing, valid for the listing cache TTL after FetchedAt
+type listingCache struct {
+	FetchedAt time.Time `json:"fetched_at"`
+	Artifacts Artifacts `json:"artifacts"`
+}
+
+// listingCachePath the cache file of the build listing in the temp dir, the base url is part of the key
+// so that listings of different API hosts never mix
+func (c Client) listingCachePath(appSlug, buildSlug string) string {
+	sum := sha256.Sum256([]byte(c.baseURL + "\x00" + appSlug + "\x00" + buildSlug))
+	return filepath.Join(os.TempDir(), cacheDirName, "artifacts-"+hex.EncodeToString(sum[:])+".json")
+}
+
+// readListingCache returns the cached listing when it is fresh, a missing, expired or corrupt cache file is a miss
+func (c Client) readListingCache(appSlug, buildSlug string) (Artifacts, bool) {
+	path := c.listingCachePath(appSlug, buildSlug)
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return Artifacts{}, false
+	}
+
+	var cache listingCache
+	if err := json.Unmarshal(content, &cache); err != nil {
+		debugf("ignoring corrupt listing cache %s: %s", path, err)
+		return Artifacts{}, false
+	}
+	if age := time.Since(cache.FetchedAt); age < 0 || age >= c.listingCacheTTL {
+		debugf("listing cache %s expired", path)
+		return Artifacts{}, false
+	}
+
+	debugf("using the listing cache %s", path)
+	return cache.Artifacts, true
+}
+
+// writeListingCache stores the listing, failing to do so only costs a live fetch on the next run
+func (c Client) writeListingCache(appSlug, buildSlug string, artifacts Artifacts) {
+	path := c.listingCachePath(appSlug, buildSlug)
+	content, err := json.Marshal(listingCache{FetchedAt: time.Now(), Artifacts: artifacts})
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		debugf("failed to create the listing cache directory: %s", err)
+		return
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		debugf("failed to write the listing cache: %s", err)
+		return
+	}
+	_, err = tmp.Write(content)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		debugf("failed to write the listing cache: %s", err)
+		removeFile(tmp.Name())
+	}
+}
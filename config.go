@@ -0,0 +1,444 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config is the step configuration, read from the step inputs by parseConfig
+type Config struct {
+	Timings bool
+
+	AuthToken  string
+	AppSlug    string
+	BuildSlug  string
+	BuildSlugs []string
+	Branch     string
+	ScanBuilds int
+	VerifyAuth bool
+	// ExportBuildInfo exports the number and commit hash of the builds
+	ExportBuildInfo bool
+
+	ArtifactName       string
+	ArtifactNameRegex  *regexp.Regexp
+	ArtifactType       string
+	ArtifactSlug       string
+	MatchNormalize     bool
+	RequireSingleMatch bool
+	IncludeExtensions  []string
+	ExcludeExtensions  []string
+	Select             string
+	FailOnNoArtifacts  bool
+	WaitForArtifacts   bool
+	WaitTimeout        time.Duration
+	WaitPollInterval   time.Duration
+
+	DryRun            bool
+	ListOnly          bool
+	PrintDownloadURLs bool
+	OutputFormat      string
+	OutputPathKey     string
+	DownloadDir       string
+	ManifestPath      string
+	DirMode           os.FileMode
+	FileMode          os.FileMode
+	OperationTimeout  time.Duration
+
+	ExpectedSHA256     string
+	ShowProgress       bool
+	Concurrency        int
+	FailFast           bool
+	Overwrite          bool
+	SkipIfExists       bool
+	MaxBytes           int64
+	WriteChecksumFile  bool
+	CheckContentType   bool
+	ResumeRetries      int
+	Extract            bool
+	RemoveArchive      bool
+	PreservePaths      bool
+	DownloadMaxRetries int
+	AttemptTimeout     time.Duration
+	IncludeBuildLog    bool
+	MinBytesPerSec     int64
+	MaxBytesPerSec     int64
+	StallTimeout       time.Duration
+	GroupByType        bool
+	FileNameTemplate   string
+	UseETagCache       bool
+
+	APITimeout            time.Duration
+	DownloadTimeout       time.Duration
+	APIMaxRetries         int
+	ListingCacheTTL       time.Duration
+	HeadCheck             bool
+	PageLimit             int
+	MaxArtifacts          int
+	AuthScheme            string
+	ExtraHeaders          http.Header
+	BaseURL               string
+	ProxyURL              *url.URL
+	CACertFile            string
+	InsecureSkipTLSVerify bool
+	MaxIdleConns          int
+	MaxIdleConnsPerHost   int
+	IdleConnTimeout       time.Duration
+}
+
+// parseConfig reads and validates the step inputs with env, os.Getenv outside of the tests
+func parseConfig(env func(string) string) (Config, error) {
+	e := envFunc(env)
+	cfg := Config{Timings: e.bool("TIMINGS", false)}
+
+	var missing []error
+
+	accessTokenKey := "API_AUTH_TOKEN"
+	cfg.AuthToken = e(accessTokenKey)
+	if tokenFile := e("API_AUTH_TOKEN_FILE"); tokenFile != "" {
+		token, err := readTokenFile(tokenFile)
+		if err != nil {
+			return Config{}, err
+		}
+		cfg.AuthToken = token
+	}
+	if cfg.AuthToken == "" {
+		missing = append(missing, errNoEnv(accessTokenKey))
+	}
+
+	appSlugKey := "APP_SLUG"
+	cfg.AppSlug = strings.TrimSpace(e.withAliases(appSlugKey, "BITRISE_APP_SLUG"))
+	if cfg.AppSlug == "" {
+		missing = append(missing, errNoEnv(appSlugKey))
+	}
+
+	// WORKFLOW_SLUG_ID and ARTIFACT_NAME are optional, selecting the latest build and every artifact when empty
+	if len(missing) > 0 {
+		return Config{}, errors.Join(missing...)
+	}
+
+	cfg.BuildSlug = strings.TrimSpace(e.withAliases("WORKFLOW_SLUG_ID", "BUILD_SLUG"))
+	cfg.BuildSlugs = splitList(e("BUILD_SLUGS"))
+	cfg.Branch = e("BRANCH")
+	cfg.ScanBuilds = e.int("SCAN_BUILDS", 0)
+	cfg.VerifyAuth = e.bool("VERIFY_AUTH", false)
+	cfg.ExportBuildInfo = e.bool("EXPORT_BUILD_INFO", false)
+
+	strictSlugs := e.bool("STRICT_SLUG_VALIDATION", false)
+	if err := validateSlug("app", cfg.AppSlug, strictSlugs); err != nil {
+		return Config{}, err
+	}
+	for _, slug := range append([]string{cfg.BuildSlug}, cfg.BuildSlugs...) {
+		if slug == "" {
+			// no build slug selects the latest build
+			continue
+		}
+		if err := validateSlug("build", slug, strictSlugs); err != nil {
+			return Config{}, err
+		}
+	}
+
+	cfg.ArtifactName = e("ARTIFACT_NAME")
+	artifactNameRegexKey := "ARTIFACT_NAME_REGEX"
+	if pattern := e(artifactNameRegexKey); pattern != "" {
+		var err error
+		if cfg.ArtifactNameRegex, err = regexp.Compile(pattern); err != nil {
+			return Config{}, fmt.Errorf("invalid %s (%s): %w", artifactNameRegexKey, pattern, err)
+		}
+	}
+	cfg.ArtifactType = e("ARTIFACT_TYPE")
+	cfg.ArtifactSlug = e("ARTIFACT_SLUG")
+	cfg.MatchNormalize = e.bool("MATCH_NORMALIZE", false)
+	cfg.RequireSingleMatch = e.bool("REQUIRE_SINGLE_MATCH", false)
+	cfg.IncludeExtensions = splitList(e("INCLUDE_EXTENSIONS"))
+	cfg.ExcludeExtensions = splitList(e("EXCLUDE_EXTENSIONS"))
+	cfg.Select = e("SELECT")
+	switch cfg.Select {
+	case "", selectNewest, selectOldest:
+	default:
+		return Config{}, fmt.Errorf("invalid SELECT (%s): expected %s or %s", cfg.Select, selectNewest, selectOldest)
+	}
+	cfg.FailOnNoArtifacts = e.bool("FAIL_ON_NO_ARTIFACTS", false)
+	cfg.WaitForArtifacts = e.bool("WAIT_FOR_ARTIFACTS", false)
+	cfg.WaitTimeout = e.seconds("WAIT_TIMEOUT_SEC", defaultWaitTimeout)
+	cfg.WaitPollInterval = e.seconds("WAIT_POLL_INTERVAL_SEC", defaultWaitPollInterval)
+
+	cfg.DryRun = e.bool("DRY_RUN", false)
+	cfg.ListOnly = e.bool("LIST_ONLY", false)
+	cfg.PrintDownloadURLs = e.bool("PRINT_DOWNLOAD_URLS", false)
+	cfg.FileNameTemplate = e("FILENAME_TEMPLATE")
+	if err := validateFileNameTemplate(cfg.FileNameTemplate); err != nil {
+		return Config{}, err
+	}
+	cfg.OutputFormat = e("OUTPUT_FORMAT")
+	cfg.OutputPathKey = e("OUTPUT_PATH_KEY")
+	if cfg.OutputPathKey == "" {
+		cfg.OutputPathKey = defaultOutputPathKey
+	}
+
+	downloadDirKey := "DOWNLOAD_DIR"
+	cfg.DownloadDir = e(downloadDirKey)
+	if cfg.DownloadDir == "" {
+		cfg.DownloadDir = "."
+	}
+	if manifestFile := e("MANIFEST_FILE"); manifestFile != "" && !cfg.toStdout() {
+		cfg.ManifestPath = filepath.Join(cfg.DownloadDir, manifestFile)
+	}
+	if cfg.toStdout() && cfg.OutputFormat == outputFormatJSON {
+		return Config{}, fmt.Errorf("%s (%s) can't be combined with the %s output format", downloadDirKey, stdoutDownloadDir, outputFormatJSON)
+	}
+
+	var err error
+	if cfg.DirMode, err = e.mode("DIR_MODE", defaultDirMode); err != nil {
+		return Config{}, err
+	}
+	if cfg.FileMode, err = e.mode("FILE_MODE", defaultFileMode); err != nil {
+		return Config{}, err
+	}
+	cfg.OperationTimeout = e.seconds("OPERATION_TIMEOUT_SEC", 0)
+
+	cfg.ExpectedSHA256 = e("EXPECTED_SHA256")
+	cfg.ShowProgress = !e.bool("NO_PROGRESS", false)
+	cfg.Concurrency = e.int("DOWNLOAD_CONCURRENCY", defaultDownloadConcurrency)
+	cfg.FailFast = e.bool("FAIL_FAST", false)
+	cfg.Overwrite = e.bool("OVERWRITE", true)
+	cfg.SkipIfExists = e.bool("SKIP_IF_EXISTS", false)
+	cfg.MaxBytes = int64(e.int("MAX_DOWNLOAD_BYTES", 0))
+	cfg.WriteChecksumFile = e.bool("WRITE_CHECKSUM_FILE", false)
+	cfg.CheckContentType = !e.bool("SKIP_CONTENT_TYPE_CHECK", false)
+	cfg.ResumeRetries = e.int("DOWNLOAD_RESUME_RETRIES", defaultResumeRetries)
+	cfg.Extract = e.bool("EXTRACT", false)
+	cfg.RemoveArchive = e.bool("EXTRACT_REMOVE_ARCHIVE", false)
+	cfg.PreservePaths = !e.bool("FLATTEN", true) || e.bool("PRESERVE_PATHS", false)
+	cfg.DownloadMaxRetries = e.int("DOWNLOAD_MAX_RETRIES", defaultDownloadMaxRetries)
+	cfg.AttemptTimeout = e.seconds("DOWNLOAD_ATTEMPT_TIMEOUT_SEC", 0)
+	cfg.IncludeBuildLog = e.bool("INCLUDE_BUILD_LOG", false)
+	cfg.MinBytesPerSec = int64(e.int("MIN_DOWNLOAD_BYTES_PER_SEC", 0))
+	cfg.StallTimeout = e.seconds("STALL_TIMEOUT_SEC", defaultStallTimeout)
+	cfg.MaxBytesPerSec = int64(e.int("MAX_DOWNLOAD_BYTES_PER_SEC", 0))
+	if cfg.MaxBytesPerSec > 0 && cfg.MinBytesPerSec > cfg.MaxBytesPerSec {
+		return Config{}, fmt.Errorf("invalid MIN_DOWNLOAD_BYTES_PER_SEC (%d): above MAX_DOWNLOAD_BYTES_PER_SEC (%d), every download would stall", cfg.MinBytesPerSec, cfg.MaxBytesPerSec)
+	}
+	cfg.GroupByType = e.bool("GROUP_BY_TYPE", false)
+	cfg.UseETagCache = e.bool("USE_ETAG_CACHE", false)
+
+	// HTTP_TIMEOUT_SEC the single timeout of the former versions
+	cfg.APITimeout = e.seconds(e.key("API_TIMEOUT_SEC", "HTTP_TIMEOUT_SEC"), defaultAPITimeout)
+	cfg.DownloadTimeout = e.seconds("DOWNLOAD_TIMEOUT_SEC", defaultDownloadTimeout)
+	cfg.APIMaxRetries = e.int("API_MAX_RETRIES", defaultMaxRetries)
+	for _, retries := range []struct {
+		key   string
+		count int
+	}{{"API_MAX_RETRIES", cfg.APIMaxRetries}, {"DOWNLOAD_MAX_RETRIES", cfg.DownloadMaxRetries}, {"DOWNLOAD_RESUME_RETRIES", cfg.ResumeRetries}} {
+		if retries.count > maxRetryCount {
+			return Config{}, fmt.Errorf("invalid %s (%d): above the maximum of %d retries", retries.key, retries.count, maxRetryCount)
+		}
+	}
+	cfg.ListingCacheTTL = e.seconds("LISTING_CACHE_TTL_SEC", 0)
+	cfg.HeadCheck = e.bool("HEAD_CHECK", false)
+	cfg.PageLimit = e.int("ARTIFACTS_PAGE_LIMIT", 0)
+	cfg.MaxArtifacts = e.int("MAX_ARTIFACTS", 0)
+	cfg.AuthScheme = strings.TrimSpace(e("AUTH_SCHEME"))
+	if cfg.AuthScheme != "" && !headerKeyPattern.MatchString(cfg.AuthScheme) {
+		return Config{}, fmt.Errorf("invalid AUTH_SCHEME (%s): expected a single word like token or Bearer", cfg.AuthScheme)
+	}
+	if cfg.ExtraHeaders, err = parseHeaders(e("EXTRA_HEADERS")); err != nil {
+		return Config{}, err
+	}
+	cfg.BaseURL = strings.TrimSuffix(e("BITRISE_API_BASE_URL"), "/")
+
+	if rawURL := e("PROXY_URL"); rawURL != "" {
+		u, err := url.Parse(rawURL)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return Config{}, fmt.Errorf("invalid PROXY_URL (%s): expected a url like http://proxy:3128", redactURL(rawURL))
+		}
+		cfg.ProxyURL = u
+	}
+	cfg.CACertFile = e("CA_CERT_FILE")
+	cfg.InsecureSkipTLSVerify = e.bool("INSECURE_SKIP_TLS_VERIFY", false)
+
+	// the Go defaults are kept when unset
+	defaults := http.DefaultTransport.(*http.Transport)
+	cfg.MaxIdleConns = e.int("MAX_IDLE_CONNS", defaults.MaxIdleConns)
+	cfg.MaxIdleConnsPerHost = e.int("MAX_IDLE_CONNS_PER_HOST", defaults.MaxIdleConnsPerHost)
+	cfg.IdleConnTimeout = e.seconds("IDLE_CONN_TIMEOUT_SEC", defaults.IdleConnTimeout)
+	return cfg, nil
+}
+
+// toStdout reports whether the artifact is written to stdout instead of a file
+func (cfg Config) toStdout() bool {
+	return cfg.DownloadDir == stdoutDownloadDir
+}
+
+// logsToStderr reports whether the logs go to stderr, keeping stdout for the JSON output, or the artifact content,
+// only. Read from env as the config parsing logs already.
+func logsToStderr(env func(string) string) bool {
+	return env("OUTPUT_FORMAT") == outputFormatJSON || env("DOWNLOAD_DIR") == stdoutDownloadDir
+}
+
+// filter returns the artifact selection criteria of the config
+func (cfg Config) filter() artifactFilter {
+	return artifactFilter{
+		artifactType:       cfg.ArtifactType,
+		name:               cfg.ArtifactName,
+		regex:              cfg.ArtifactNameRegex,
+		matchNormalize:     cfg.MatchNormalize,
+		requireSingleMatch: cfg.RequireSingleMatch,
+		includeExtensions:  cfg.IncludeExtensions,
+		excludeExtensions:  cfg.ExcludeExtensions,
+		order:              cfg.Select,
+	}
+}
+
+// newClient returns the API client configured by cfg
+func (cfg Config) newClient() (Client, error) {
+	transport, err := cfg.transport()
+	if err != nil {
+		return Client{}, err
+	}
+
+	c := NewWithTimeouts(cfg.AuthToken, cfg.APITimeout, cfg.DownloadTimeout)
+	c.setTransport(transport)
+	c.maxRetries = cfg.APIMaxRetries
+	c.listingCacheTTL = cfg.ListingCacheTTL
+	c.headCheck = cfg.HeadCheck
+	c.pageLimit = cfg.PageLimit
+	c.maxArtifacts = cfg.MaxArtifacts
+	if cfg.AuthScheme != "" {
+		WithAuthScheme(cfg.AuthScheme)(&c)
+	}
+	for key, values := range cfg.ExtraHeaders {
+		for _, value := range values {
+			WithHeader(key, value)(&c)
+		}
+	}
+	if cfg.BaseURL != "" {
+		c.baseURL = cfg.BaseURL
+	}
+	return c, nil
+}
+
+// downloader returns the downloader of the build artifacts configured by cfg
+func (cfg Config) downloader(c Client, buildSlug string) downloader {
+	var limiter *rateLimiter
+	if cfg.MaxBytesPerSec > 0 {
+		infof("downloads limited to %s", formatRate(cfg.MaxBytesPerSec))
+		limiter = newRateLimiter(cfg.MaxBytesPerSec)
+	}
+	return downloader{
+		client:            c,
+		appSlug:           cfg.AppSlug,
+		buildSlug:         buildSlug,
+		downloadDir:       cfg.DownloadDir,
+		expectedSHA256:    cfg.ExpectedSHA256,
+		showProgress:      cfg.ShowProgress,
+		concurrency:       cfg.Concurrency,
+		failFast:          cfg.FailFast,
+		overwrite:         cfg.Overwrite,
+		skipIfExists:      cfg.SkipIfExists,
+		maxBytes:          cfg.MaxBytes,
+		writeChecksumFile: cfg.WriteChecksumFile,
+		fileMode:          cfg.FileMode,
+		checkContentType:  cfg.CheckContentType,
+		resumeRetries:     cfg.ResumeRetries,
+		extract:           cfg.Extract,
+		removeArchive:     cfg.RemoveArchive,
+		dirMode:           cfg.DirMode,
+		preservePaths:     cfg.PreservePaths,
+		maxRetries:        cfg.DownloadMaxRetries,
+		attemptTimeout:    cfg.AttemptTimeout,
+		includeBuildLog:   cfg.IncludeBuildLog,
+		minBytesPerSec:    cfg.MinBytesPerSec,
+		stallTimeout:      cfg.StallTimeout,
+		limiter:           limiter,
+		groupByType:       cfg.GroupByType,
+		fileNameTemplate:  cfg.FileNameTemplate,
+		useETagCache:      cfg.UseETagCache,
+	}
+}
+
+// envFunc returns the value of an environment variable, like os.Getenv
+type envFunc func(string) string
+
+// withAliases returns the value of the first set env var, the step input name first and then its aliases
+func (env envFunc) withAliases(name string, aliases ...string) string {
+	return env(env.key(name, aliases...))
+}
+
+// key returns the name of the first set env var, the step input name first and then its aliases,
+// the step input name when none is set
+func (env envFunc) key(name string, aliases ...string) string {
+	if env(name) != "" {
+		return name
+	}
+	for _, alias := range aliases {
+		if env(alias) != "" {
+			infof("%s not set, using its alias (%s)", name, alias)
+			return alias
+		}
+	}
+	return name
+}
+
+// mode parses the octal permissions of the environment variable, like 0750
+func (env envFunc) mode(key string, defaultValue os.FileMode) (os.FileMode, error) {
+	value := env(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	mode, err := strconv.ParseUint(value, 8, 32)
+	if err != nil || mode > uint64(os.ModePerm) {
+		return 0, fmt.Errorf("invalid %s (%s): expected octal permissions like 0750", key, value)
+	}
+	return os.FileMode(mode), nil
+}
+
+func (env envFunc) int(key string, defaultValue int) int {
+	value := env(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	i, err := strconv.Atoi(value)
+	if err != nil || i < 0 {
+		warnf("Invalid value (%s) for environment variable (%s), using default: %d", value, key, defaultValue)
+		return defaultValue
+	}
+	return i
+}
+
+func (env envFunc) bool(key string, defaultValue bool) bool {
+	value := env(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		warnf("Invalid value (%s) for environment variable (%s), using default: %t", value, key, defaultValue)
+		return defaultValue
+	}
+	return b
+}
+
+func (env envFunc) seconds(key string, defaultValue time.Duration) time.Duration {
+	value := env(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds <= 0 {
+		warnf("Invalid value (%s) for environment variable (%s), using default: %s", value, key, defaultValue)
+		return defaultValue
+	}
+	return time.Duration(seconds) * time.Second
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseConfigBoundsRetries(t *testing.T) {
+	for _, key := range []string{"API_MAX_RETRIES", "DOWNLOAD_MAX_RETRIES", "DOWNLOAD_RESUME_RETRIES"} {
+		env := map[string]string{"API_AUTH_TOKEN": "token", "APP_SLUG": "app", key: "11"}
+		_, err := parseConfig(func(k string) string { return env[k] })
+		if err == nil || !strings.Contains(err.Error(), "invalid "+key+" (11)") {
+			t.Errorf("%s: got %v, want an invalid %s error", key, err, key)
+		}
+
+		env[key] = "10"
+		if _, err := parseConfig(func(k string) string { return env[k] }); err != nil {
+			t.Errorf("%s: got %v, want 10 retries accepted", key, err)
+		}
+	}
+}
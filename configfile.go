@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// configFileKey env var of the JSON file of the step inputs, also set by the --config flag
+const configFileKey = "CONFIG_FILE"
+
+// configFile step inputs read from a JSON file, by env var name
+type configFile struct {
+	path   string
+	values map[string]string
+	// used env var names looked up in the file
+	used map[string]bool
+}
+
+// readConfigFile reads the JSON object of the step inputs, whose keys are the env var names, case insensitive,
+// like app_slug or DOWNLOAD_DIR, or the flag names, like token. The lists, like build_slugs, can be JSON arrays.
+func readConfigFile(path string) (*configFile, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the config file (%s): %w", path, err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+	var raw map[string]interface{}
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("invalid config file (%s): expected a JSON object of the step inputs: %w", path, err)
+	}
+
+	file := &configFile{path: path, values: map[string]string{}, used: map[string]bool{}}
+	for key, value := range raw {
+		s, err := configValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid (%s) in the config file (%s): %w", key, path, err)
+		}
+		file.values[configKeyEnv(key)] = s
+	}
+	return file, nil
+}
+
+// configKeyEnv returns the env var name of the config file key
+func configKeyEnv(key string) string {
+	name := strings.ReplaceAll(strings.ToLower(strings.TrimSpace(key)), "_", "-")
+	for _, f := range flagEnvs {
+		if f.name == name {
+			return f.env
+		}
+	}
+	return strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// configValue returns the env var value of the JSON value, the arrays being comma-separated
+func configValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return fmt.Sprint(v), nil
+	case json.Number:
+		return v.String(), nil
+	case []interface{}:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			if _, isList := item.([]interface{}); isList {
+				return "", fmt.Errorf("nested lists are not supported")
+			}
+			s, err := configValue(item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, s)
+		}
+		return strings.Join(items, nameListSeparator), nil
+	default:
+		return "", fmt.Errorf("expected a string, a number, a boolean or a list")
+	}
+}
+
+// under returns env falling back to the config file values, the env vars set override the file
+func (f *configFile) under(env func(string) string) func(string) string {
+	return func(key string) string {
+		if value := env(key); value != "" {
+			return value
+		}
+		if value, ok := f.values[key]; ok {
+			f.used[key] = true
+			return value
+		}
+		return ""
+	}
+}
+
+// warnUnused warns about the config file keys matching no step input, like a typo
+func (f *configFile) warnUnused() {
+	var unused []string
+	for key := range f.values {
+		if !f.used[key] {
+			unused = append(unused, key)
+		}
+	}
+	if len(unused) == 0 {
+		return
+	}
+	sort.Strings(unused)
+	warnf("Config file (%s) inputs not used, unknown or overridden by an env var: %s", f.path, strings.Join(unused, ", "))
+}
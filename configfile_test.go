@@ -0,0 +1,80 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// writeConfigFile writes the JSON config file and returns its path
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestConfigPrecedence(t *testing.T) {
+	path := writeConfigFile(t, `{
+		"token": "file-token",
+		"APP_SLUG": "file-app",
+		"download_dir": "file-dir",
+		"build-slugs": ["build-1", "build-2"],
+		"concurrency": 1
+	}`)
+	// restored at the end of the test, as the flags set them
+	t.Setenv("APP_SLUG", "")
+	t.Setenv("DOWNLOAD_DIR", "env-dir")
+	t.Setenv("API_AUTH_TOKEN", "")
+	t.Setenv("DOWNLOAD_CONCURRENCY", "")
+	if err := parseFlags([]string{"step", "--app-slug", "flag-app"}); err != nil {
+		t.Fatalf("parseFlags: %v", err)
+	}
+
+	file, err := readConfigFile(path)
+	if err != nil {
+		t.Fatalf("readConfigFile: %v", err)
+	}
+	cfg, err := parseConfig(file.under(os.Getenv))
+	if err != nil {
+		t.Fatalf("parseConfig: %v", err)
+	}
+
+	if cfg.AppSlug != "flag-app" {
+		t.Errorf("AppSlug = %q, want the flag to override the env and the file", cfg.AppSlug)
+	}
+	if cfg.DownloadDir != "env-dir" {
+		t.Errorf("DownloadDir = %q, want the env var to override the file", cfg.DownloadDir)
+	}
+	if cfg.AuthToken != "file-token" {
+		t.Errorf("AuthToken = %q, want the file value of the token flag name", cfg.AuthToken)
+	}
+	if !slices.Equal(cfg.BuildSlugs, []string{"build-1", "build-2"}) {
+		t.Errorf("BuildSlugs = %q, want the JSON array of the file", cfg.BuildSlugs)
+	}
+	if !file.used["API_AUTH_TOKEN"] || file.used["DOWNLOAD_DIR"] || file.used["CONCURRENCY"] {
+		t.Errorf("used = %v, want the overridden and unknown keys unused", file.used)
+	}
+}
+
+func TestReadConfigFileInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{name: "not an object", content: `["app"]`, want: "expected a JSON object of the step inputs"},
+		{name: "nested list", content: `{"build_slugs": [["build"]]}`, want: "nested lists are not supported"},
+		{name: "object value", content: `{"app_slug": {"slug": "app"}}`, want: "expected a string, a number, a boolean or a list"},
+	}
+	for _, tt := range tests {
+		_, err := readConfigFile(writeConfigFile(t, tt.content))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,905 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// errAttemptTimeout cause of the cancellation of a download attempt reaching the attempt timeout
+var errAttemptTimeout = errors.New("download attempt timed out")
+
+// partSuffix suffix of the files being downloaded, renamed to their final name once complete
+const partSuffix = ".part"
+
+// checksumSuffix suffix of the checksum files written next to the downloads
+const checksumSuffix = ".sha256"
+
+// sniffLen number of bytes used by http.DetectContentType
+const sniffLen = 512
+
+var binaryArtifactTypes = []string{"android-apk", "ios-ipa"}
+var binaryExtensions = []string{".apk", ".aab", ".ipa", ".zip"}
+
+// downloader downloads the artifacts of a build into downloadDir
+type downloader struct {
+	client      Client
+	appSlug     string
+	buildSlug   string
+	downloadDir string
+	// expectedSHA256 when set, the hex digest every downloaded file must match
+	expectedSHA256 string
+	showProgress   bool
+	// concurrency maximum number of parallel downloads of downloadAll
+	concurrency int
+	// failFast when true, the first failed download of downloadAll, or build of downloadBuilds, cancels the others,
+	// otherwise every download is attempted and the errors are reported together
+	failFast bool
+	// overwrite when false, an existing destination file fails the download
+	overwrite bool
+	// skipIfExists when true, an existing destination file is kept and the download skipped
+	skipIfExists bool
+	// maxBytes maximum size of a downloaded file, zero means no limit
+	maxBytes int64
+	// writeChecksumFile when true, a sha256sum compatible <file>.sha256 file is written next to each download
+	writeChecksumFile bool
+	// fileMode permissions of the created files
+	fileMode os.FileMode
+	// checkContentType when true, a binary artifact served as an HTML page fails the download
+	checkContentType bool
+	// resumeRetries number of times a download interrupted by a network error is resumed from where it stopped
+	resumeRetries int
+	// extract when true, a downloaded zip archive is extracted next to it, and removed with removeArchive
+	extract       bool
+	removeArchive bool
+	// dirMode permissions of the created directories
+	dirMode os.FileMode
+	// maxRetries number of new attempts of a failed download, each with a fresh expiring download url,
+	// attemptTimeout bounds each attempt when positive
+	maxRetries     int
+	attemptTimeout time.Duration
+	// preservePaths when true, the directories of a path-like artifact title are created in downloadDir,
+	// otherwise the file is named after its base name
+	preservePaths bool
+	// includeBuildLog when true, the raw log of the build is downloaded next to its artifacts
+	includeBuildLog bool
+	// minBytesPerSec when positive, a download slower than it on average over stallTimeout is aborted
+	minBytesPerSec int64
+	stallTimeout   time.Duration
+	// limiter when set, caps the rate of the downloads sharing it
+	limiter *rateLimiter
+	// groupByType when true, downloadAll saves the artifacts in subdirectories of downloadDir named after their type
+	groupByType bool
+	// fileNameTemplate when set, names the downloaded files from placeholders like {build_slug}-{title}
+	fileNameTemplate string
+	// useETagCache when true, the ETag of each download is kept next to the file, and an existing file whose
+	// ETag the server still answers with 304 Not Modified is kept instead of downloaded again
+	useETagCache bool
+}
+
+type downloadResult struct {
+	Slug         string `json:"slug"`
+	Title        string `json:"title"`
+	ArtifactType string `json:"artifact_type"`
+	Path         string `json:"path"`
+	Bytes        int64  `json:"bytes"`
+	SHA256       string `json:"sha256,omitempty"`
+	// PublicInstallPageURL empty when the public page of the artifact is not enabled
+	PublicInstallPageURL string `json:"public_install_page_url,omitempty"`
+	// Skipped the destination file already existed and was kept
+	Skipped bool `json:"skipped,omitempty"`
+	// NotModified the server answered 304 Not Modified to the ETag of the existing file, which was kept
+	NotModified bool `json:"not_modified,omitempty"`
+	// DurationMs duration of the transfer, AvgBytesPerSec its average rate, counting only the bytes
+	// transferred by this run when a download is resumed
+	DurationMs     int64 `json:"duration_ms,omitempty"`
+	AvgBytesPerSec int64 `json:"avg_bytes_per_sec,omitempty"`
+	// DownloadedAt RFC3339 time the download completed, empty when skipped or not modified
+	DownloadedAt string `json:"downloaded_at,omitempty"`
+	// ExtractedPath directory the zip archive was extracted into, ExtractedFiles its number of files
+	ExtractedPath  string `json:"extracted_path,omitempty"`
+	ExtractedFiles int    `json:"extracted_files,omitempty"`
+}
+
+// download saves the artifact as fileName in downloadDir
+func (d downloader) download(ctx context.Context, artifact ArtifactListItem, fileName string) (downloadResult, error) {
+	return d.downloadWithDetails(ctx, artifact, fileName, nil)
+}
+
+// downloadWithDetails is download with the artifact details already fetched, if any, used by the first attempt
+// instead of fetching them again, the retries fetch a fresh expiring download url
+func (d downloader) downloadWithDetails(ctx context.Context, artifact ArtifactListItem, fileName string, details *Artifact) (downloadResult, error) {
+	for attempt := 0; ; attempt++ {
+		result, err := d.downloadAttempt(ctx, artifact, fileName, details)
+		details = nil
+		if err == nil || attempt >= d.maxRetries || ctx.Err() != nil || !isRetryableDownloadError(err) {
+			return result, err
+		}
+
+		delay := backoff(attempt)
+		warnf("Download of (%s) failed: %s, retrying in %s (%d/%d)", fileName, err, delay, attempt+1, d.maxRetries)
+		if err := sleepCtx(ctx, delay); err != nil {
+			return result, err
+		}
+	}
+}
+
+// downloadTo writes the artifact of the details into w, like stdout, with the size limit, stall watch and content
+// type check of the downloads to a file, verifying its size and checksum once written.
+// Unlike the downloads to a file, it is neither resumed nor retried, as w can't be rewound.
+func (d downloader) downloadTo(ctx context.Context, details Artifact, w io.Writer) (downloadResult, error) {
+	artifact := details.Data
+	result := downloadResult{Slug: artifact.Slug, Title: artifact.Title, ArtifactType: artifact.ArtifactType}
+
+	if d.maxBytes > 0 && artifact.FileSizeBytes > d.maxBytes {
+		return result, fmt.Errorf("size of (%s) [%d byte] exceeds the maximum download size [%d byte]", artifact.Title, artifact.FileSizeBytes, d.maxBytes)
+	}
+
+	ctx, stall, stopStallWatch := d.startStallWatch(ctx)
+	defer stopStallWatch()
+
+	start := time.Now()
+	resp, details, err := d.client.openDownloadRefreshing(ctx, d.appSlug, d.buildSlug, details, 0, "")
+	if err != nil {
+		return result, stallCause(ctx, artifact.Title, err)
+	}
+	defer responseBodyCloser(resp)
+	// the size may have been learnt from the HEAD check
+	artifact.FileSizeBytes = details.Data.FileSizeBytes
+
+	if resp.StatusCode >= 300 || resp.StatusCode < 200 {
+		return result, &APIError{Operation: fmt.Sprintf("download (%s)", artifact.Title), StatusCode: resp.StatusCode, Endpoint: redactURL(details.Data.ExpiringDownloadURL), AppSlug: d.appSlug, BuildSlug: d.buildSlug, Body: readBodySnippet(resp), Download: true}
+	}
+
+	var body io.Reader = resp.Body
+	if d.checkContentType && isBinaryArtifact(artifact.ArtifactType, artifact.Title) {
+		if body, err = checkNotHTML(resp); err != nil {
+			return result, fmt.Errorf("failed to download (%s): %w", artifact.Title, err)
+		}
+	}
+	if stall != nil {
+		body = stall.wrap(body)
+	}
+	if d.maxBytes > 0 {
+		// read one byte past the limit to detect the oversized downloads
+		body = io.LimitReader(body, d.maxBytes+1)
+	}
+	if d.limiter != nil {
+		w = throttledWriter{ctx: ctx, writer: w, limiter: d.limiter}
+	}
+
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(w, hash), body)
+	timings.track(phaseDownload, start)
+	result.Bytes = n
+	duration := time.Since(start)
+	result.DurationMs = duration.Milliseconds()
+	result.AvgBytesPerSec = bytesPerSecond(n, duration)
+	if err != nil {
+		return result, stallCause(ctx, artifact.Title, err)
+	}
+	if d.maxBytes > 0 && result.Bytes > d.maxBytes {
+		return result, fmt.Errorf("download of (%s) exceeds the maximum download size [%d byte]", artifact.Title, d.maxBytes)
+	}
+	result.SHA256 = hex.EncodeToString(hash.Sum(nil))
+
+	if artifact.FileSizeBytes > 0 && result.Bytes != artifact.FileSizeBytes {
+		return result, fmt.Errorf("size mismatch for (%s): expected %d got %d", artifact.Title, artifact.FileSizeBytes, result.Bytes)
+	}
+	if expected, source := d.expectedChecksum(artifact.SHA256); expected != "" && !strings.EqualFold(expected, result.SHA256) {
+		return result, fmt.Errorf("checksum mismatch for (%s): expected %s from %s got %s", artifact.Title, expected, source, result.SHA256)
+	}
+	return result, nil
+}
+
+// downloadAttempt downloads the artifact with the given details, or with a fresh expiring download url when nil,
+// within attemptTimeout when set
+func (d downloader) downloadAttempt(ctx context.Context, artifact ArtifactListItem, fileName string, fetched *Artifact) (downloadResult, error) {
+	if d.attemptTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, d.attemptTimeout, errAttemptTimeout)
+		defer cancel()
+	}
+
+	var details Artifact
+	if fetched != nil {
+		details = *fetched
+	} else {
+		var err error
+		if details, err = d.client.GetArtifactDetailsCtx(ctx, d.appSlug, d.buildSlug, artifact.Slug); err != nil {
+			return downloadResult{Title: artifact.Title, Path: filepath.Join(d.downloadDir, fileName)}, err
+		}
+	}
+	if details.Data.ArtifactType == "" {
+		details.Data.ArtifactType = artifact.ArtifactType
+	}
+	return d.downloadDetails(ctx, details, fileName)
+}
+
+// isRetryableDownloadError reports whether a new download attempt can succeed: after a network error,
+// an attempt timeout, a stall, or a 5xx, 408 or 429 status code
+func isRetryableDownloadError(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode >= 500 || apiErr.StatusCode == http.StatusRequestTimeout || apiErr.StatusCode == http.StatusTooManyRequests
+	}
+	return errors.Is(err, errAttemptTimeout) || errors.Is(err, errDownloadStalled) || errors.Is(err, context.DeadlineExceeded) || isTransientReadError(err)
+}
+
+// downloadDetails saves the artifact as fileName in downloadDir, hashing it while it is streamed to the disk.
+// The data is written to a .part file renamed to fileName only once complete and verified, so consumers never
+// see a partial artifact at the final path. A .part file failing the verifications is removed, one left by
+// an interrupted download is resumed with a Range request when the server supports it.
+func (d downloader) downloadDetails(ctx context.Context, details Artifact, fileName string) (downloadResult, error) {
+	artifact := details.Data
+	result := downloadResult{Slug: artifact.Slug, Title: artifact.Title, ArtifactType: artifact.ArtifactType}
+
+	path, err := d.destinationPath(fileName)
+	if err != nil {
+		return result, err
+	}
+	result.Path = path
+	partPath := result.Path + partSuffix
+	if d.preservePaths {
+		if err := os.MkdirAll(filepath.Dir(result.Path), d.dirMode); err != nil {
+			return result, fmt.Errorf("failed to create the directory of (%s): %w", fileName, err)
+		}
+	}
+
+	var cachedETag string
+	if _, err := os.Stat(result.Path); err == nil {
+		switch {
+		case d.skipIfExists:
+			result.Skipped = true
+			return result, nil
+		case !d.overwrite:
+			return result, fmt.Errorf("destination (%s) already exists and overwrite is disabled", result.Path)
+		}
+		if d.useETagCache {
+			cachedETag = readETag(result.Path)
+		}
+		if cachedETag == "" {
+			infof("%s: overwriting existing file", result.Path)
+		}
+	}
+
+	result.PublicInstallPageURL, _ = details.PublicInstallPageURL()
+
+	if d.maxBytes > 0 && artifact.FileSizeBytes > d.maxBytes {
+		return result, fmt.Errorf("size of (%s) [%d byte] exceeds the maximum download size [%d byte]", fileName, artifact.FileSizeBytes, d.maxBytes)
+	}
+
+	var offset int64
+	if info, err := os.Stat(partPath); err == nil {
+		offset = info.Size()
+		// the partial download of a newer version is resumed
+		cachedETag = ""
+	}
+	// a .part file without state, like one of an older version of the step, is resumed unchecked
+	state, hasState := readResumeState(partPath)
+	if offset > 0 && hasState {
+		if err := state.validate(artifact.Slug, artifact.FileSizeBytes, offset); err != nil {
+			warnf("Discarding the partial download of (%s), %s", fileName, err)
+			offset = 0
+		}
+	}
+
+	ctx, stall, stopStallWatch := d.startStallWatch(ctx)
+	defer stopStallWatch()
+
+	start := time.Now()
+	resp, details, err := d.client.openDownloadRefreshing(ctx, d.appSlug, d.buildSlug, details, offset, cachedETag)
+	if err != nil {
+		return result, stallCause(ctx, fileName, err)
+	}
+	if offset > 0 && hasState && resp.StatusCode == http.StatusPartialContent && !state.sameContent(resp) {
+		warnf("(%s) changed since the partial download, restarting it", fileName)
+		responseBodyCloser(resp)
+		offset = 0
+		if resp, details, err = d.client.openDownloadRefreshing(ctx, d.appSlug, d.buildSlug, details, offset, ""); err != nil {
+			return result, stallCause(ctx, fileName, err)
+		}
+	}
+	// resp is replaced when an interrupted download is resumed
+	defer func() { responseBodyCloser(resp) }()
+	// the size may have been learnt from the HEAD check
+	artifact.FileSizeBytes = details.Data.FileSizeBytes
+
+	if cachedETag != "" && resp.StatusCode == http.StatusNotModified {
+		result.NotModified = true
+		return result, nil
+	}
+	if resp.StatusCode >= 300 || resp.StatusCode < 200 {
+		return result, &APIError{Operation: fmt.Sprintf("download (%s)", fileName), StatusCode: resp.StatusCode, Endpoint: redactURL(details.Data.ExpiringDownloadURL), AppSlug: d.appSlug, BuildSlug: d.buildSlug, Body: readBodySnippet(resp), Download: true}
+	}
+
+	var body io.Reader = resp.Body
+	if d.checkContentType && isBinaryArtifact(artifact.ArtifactType, fileName) {
+		if body, err = checkNotHTML(resp); err != nil {
+			return result, fmt.Errorf("failed to download (%s): %w", fileName, err)
+		}
+	}
+
+	hash := sha256.New()
+	var file *os.File
+	if offset > 0 && resp.StatusCode == http.StatusPartialContent {
+		infof("%s: resuming download from byte %d", fileName, offset)
+		if file, err = os.OpenFile(partPath, os.O_RDWR, 0); err != nil {
+			return result, fmt.Errorf("failed to resume the download of (%s): %w", fileName, err)
+		}
+		// hash the already downloaded part, leaving the file offset at its end for the append
+		if result.Bytes, err = io.Copy(hash, file); err != nil {
+			closeFile(file)
+			return result, err
+		}
+	} else {
+		if offset > 0 {
+			warnf("Range requests not supported for (%s), restarting the download", fileName)
+		}
+		if file, err = os.OpenFile(partPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, d.fileMode); err != nil {
+			return result, fmt.Errorf("failed to create the download file of (%s): %w", fileName, err)
+		}
+	}
+	state = newResumeState(artifact.Slug, artifact.FileSizeBytes, resp)
+	state.Offset = result.Bytes
+	writeResumeState(partPath, state, d.fileMode)
+
+	var transferred int64
+	for retry := 0; ; retry++ {
+		if d.showProgress {
+			body = newProgressReader(body, fileName, result.Bytes, artifact.FileSizeBytes)
+		}
+		if stall != nil {
+			body = stall.wrap(body)
+		}
+		if d.limiter != nil {
+			body = throttledReader{ctx: ctx, reader: body, limiter: d.limiter}
+		}
+		if d.maxBytes > 0 {
+			// read one byte past the limit to detect the oversized downloads
+			body = io.LimitReader(body, d.maxBytes-result.Bytes+1)
+		}
+
+		var n int64
+		n, err = io.Copy(file, io.TeeReader(body, hash))
+		result.Bytes += n
+		transferred += n
+		if err == nil || retry >= d.resumeRetries || ctx.Err() != nil || !isTransientReadError(err) {
+			break
+		}
+
+		warnf("Download of (%s) interrupted after [%d byte]: %s, resuming (%d/%d)", fileName, result.Bytes, err, retry+1, d.resumeRetries)
+		responseBodyCloser(resp)
+		if err = sleepCtx(ctx, backoff(retry)); err != nil {
+			break
+		}
+		if resp, details, err = d.client.openDownloadRefreshing(ctx, d.appSlug, d.buildSlug, details, result.Bytes, ""); err != nil {
+			// nothing left to close
+			resp = &http.Response{Body: http.NoBody}
+			break
+		}
+		// nothing received yet, the whole content is as good as a partial one
+		restarted := result.Bytes == 0 && resp.StatusCode == http.StatusOK
+		if resp.StatusCode != http.StatusPartialContent && !restarted {
+			err = fmt.Errorf("failed to resume the download of (%s) with status code (%d)", fileName, resp.StatusCode)
+			break
+		}
+		if !restarted && !state.sameContent(resp) {
+			// the stale state makes the next run restart the download
+			err = fmt.Errorf("failed to resume the download of (%s): the remote file changed", fileName)
+			break
+		}
+		body = resp.Body
+	}
+	timings.track(phaseDownload, start)
+	duration := time.Since(start)
+	result.DurationMs = duration.Milliseconds()
+	result.AvgBytesPerSec = bytesPerSecond(transferred, duration)
+	if err != nil {
+		err = stallCause(ctx, fileName, err)
+	}
+	if err == nil {
+		// flush before the rename, so a crash can't leave a truncated file at the final path
+		err = file.Sync()
+	}
+	// the close error can report a failed write on some filesystems, it fails the download
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil && errors.Is(err, syscall.ENOSPC) {
+		// resuming can't succeed until some space is freed
+		removePartFile(partPath)
+		return result, errDiskFull(result.Path, result.Bytes, err)
+	}
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) && !errors.Is(context.Cause(ctx), errAttemptTimeout) {
+			// the whole operation timed out, no later run is expected to resume it
+			removePartFile(partPath)
+		} else {
+			state.Offset = result.Bytes
+			writeResumeState(partPath, state, d.fileMode)
+		}
+		return result, err
+	}
+
+	if d.maxBytes > 0 && result.Bytes > d.maxBytes {
+		removePartFile(partPath)
+		return result, fmt.Errorf("download of (%s) exceeds the maximum download size [%d byte]", fileName, d.maxBytes)
+	}
+	result.SHA256 = hex.EncodeToString(hash.Sum(nil))
+
+	if artifact.FileSizeBytes > 0 && result.Bytes != artifact.FileSizeBytes {
+		removePartFile(partPath)
+		return result, fmt.Errorf("size mismatch for (%s): expected %d got %d", fileName, artifact.FileSizeBytes, result.Bytes)
+	}
+
+	if expected, source := d.expectedChecksum(artifact.SHA256); expected != "" {
+		if !strings.EqualFold(expected, result.SHA256) {
+			removePartFile(partPath)
+			return result, fmt.Errorf("checksum mismatch for (%s): expected %s from %s got %s", fileName, expected, source, result.SHA256)
+		}
+		infof("%s: sha256 verified against %s", fileName, source)
+	}
+
+	if err := os.Rename(partPath, result.Path); err != nil {
+		return result, fmt.Errorf("failed to move the download of (%s) to its destination: %w", fileName, err)
+	}
+	removeResumeState(partPath)
+	if d.useETagCache {
+		writeETag(result.Path, state.ETag, d.fileMode)
+	}
+
+	result.DownloadedAt = time.Now().UTC().Format(time.RFC3339)
+
+	if d.writeChecksumFile {
+		if err := writeChecksumFile(result.Path, result.SHA256, d.fileMode); err != nil {
+			return result, err
+		}
+	}
+
+	if d.extract {
+		if err := d.extractArchive(&result); err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
+
+// expectedChecksum returns the sha256 the download must match and where it comes from: EXPECTED_SHA256,
+// or else the checksum reported by the API, empty when neither is set and only the size is verified
+func (d downloader) expectedChecksum(apiSHA256 string) (sum, source string) {
+	switch {
+	case d.expectedSHA256 != "":
+		return d.expectedSHA256, "EXPECTED_SHA256"
+	case apiSHA256 != "":
+		return apiSHA256, "the API"
+	}
+	return "", ""
+}
+
+// extractArchive extracts the downloaded file when it is a zip archive, and removes the archive
+// with removeArchive, the result path becoming the extraction directory
+func (d downloader) extractArchive(result *downloadResult) error {
+	archive, err := isZip(result.Path, result.ArtifactType)
+	if err != nil || !archive {
+		return err
+	}
+
+	dir := extractDir(result.Path)
+	if result.ExtractedFiles, err = extractZip(result.Path, dir, d.dirMode, d.fileMode); err != nil {
+		return fmt.Errorf("failed to extract (%s): %w", result.Path, err)
+	}
+	result.ExtractedPath = dir
+	infof("%s: %d files extracted into (%s)", result.Title, result.ExtractedFiles, dir)
+
+	if d.removeArchive {
+		if err := os.Remove(result.Path); err != nil {
+			return err
+		}
+		result.Path = dir
+	}
+	return nil
+}
+
+// downloadBuilds downloads the artifacts selected by the filter from each build, into a subdirectory
+// of downloadDir named by the build slug. A failed build does not stop the others unless failFast, the results of
+// every successful download are returned.
+func (d downloader) downloadBuilds(ctx context.Context, buildSlugs []string, filter artifactFilter) ([]downloadResult, error) {
+	var (
+		results           []downloadResult
+		succeeded, failed []string
+		errs              []error
+	)
+	for _, buildSlug := range buildSlugs {
+		buildResults, err := d.downloadBuild(ctx, buildSlug, filter)
+		results = append(results, buildResults...)
+		if err != nil {
+			warnf("Failed to download from build (%s): %+v", buildSlug, err)
+			failed = append(failed, fmt.Sprintf("%s: %+v", buildSlug, err))
+			errs = append(errs, fmt.Errorf("build (%s): %w", buildSlug, err))
+			if d.failFast {
+				break
+			}
+			continue
+		}
+		succeeded = append(succeeded, fmt.Sprintf("%s: %d artifacts", buildSlug, len(buildResults)))
+	}
+
+	infof("done, %d/%d builds downloaded", len(succeeded), len(buildSlugs))
+	if len(succeeded) > 0 {
+		infof("succeeded:\n  %s", strings.Join(succeeded, "\n  "))
+	}
+	if len(failed) > 0 {
+		infof("failed:\n  %s", strings.Join(failed, "\n  "))
+		if d.failFast {
+			return results, fmt.Errorf("FAIL_FAST stopped the downloads after a failure, %d of %d builds downloaded: %w", len(succeeded), len(buildSlugs), errs[0])
+		}
+		return results, fmt.Errorf("failed to download from %d of %d builds: %w", len(failed), len(buildSlugs), errors.Join(errs...))
+	}
+	return results, nil
+}
+
+func (d downloader) downloadBuild(ctx context.Context, buildSlug string, filter artifactFilter) ([]downloadResult, error) {
+	dirName, err := sanitizeFileName(buildSlug)
+	if err != nil {
+		return nil, err
+	}
+	d.buildSlug = buildSlug
+	d.downloadDir = filepath.Join(d.downloadDir, dirName)
+
+	artifacts, err := d.client.GetArtifactsForBuildOfTypeCtx(ctx, d.appSlug, buildSlug, filter.artifactType)
+	if err != nil {
+		return nil, err
+	}
+	if len(artifacts.Data) == 0 {
+		return nil, errNoArtifacts(buildSlug, filter.artifactType)
+	}
+
+	selected, err := selectArtifacts(artifacts.Data, filter)
+	if err != nil {
+		return nil, err
+	}
+	if selected, err = refineSelection(selected, filter); err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(d.downloadDir, d.dirMode); err != nil {
+		return nil, fmt.Errorf("failed to create the download directory: %w", err)
+	}
+	if d.includeBuildLog {
+		if _, err := d.downloadBuildLog(ctx); err != nil {
+			return nil, err
+		}
+	}
+	results, err := d.downloadAll(ctx, selected.artifacts)
+	if err != nil {
+		return results, err
+	}
+	return results, errMissingArtifacts(selected.missing)
+}
+
+// isTransientReadError reports whether the read of a download body failed on a network error,
+// unlike a write to the disk, so resuming it can succeed
+func isTransientReadError(err error) bool {
+	if errors.Is(err, syscall.ENOSPC) {
+		return false
+	}
+	var netErr net.Error
+	return errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) || errors.As(err, &netErr)
+}
+
+// writeChecksumFile writes the digest of the file next to it, in the format checked by `sha256sum -c`
+func writeChecksumFile(path, digest string, mode os.FileMode) error {
+	content := fmt.Sprintf("%s  %s\n", digest, filepath.Base(path))
+	return os.WriteFile(path+checksumSuffix, []byte(content), mode)
+}
+
+// isBinaryArtifact reports whether the artifact is a binary, by type or by file extension
+func isBinaryArtifact(artifactType, fileName string) bool {
+	for _, t := range binaryArtifactTypes {
+		if artifactType == t {
+			return true
+		}
+	}
+	ext := strings.ToLower(filepath.Ext(fileName))
+	for _, e := range binaryExtensions {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// checkNotHTML returns the body of the response, or an error when it is an HTML page, like the error
+// pages some storage backends serve with a 200 status code
+func checkNotHTML(resp *http.Response) (io.Reader, error) {
+	if mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type")); err == nil && mediaType == "text/html" {
+		return nil, fmt.Errorf("served as %s instead of a binary", mediaType)
+	}
+
+	// errors, like a body shorter than the sniffed length, are left to the copy of the body
+	body := bufio.NewReaderSize(resp.Body, sniffLen)
+	head, _ := body.Peek(sniffLen)
+	if contentType := http.DetectContentType(head); strings.HasPrefix(contentType, "text/html") {
+		return nil, fmt.Errorf("content looks like %s instead of a binary", contentType)
+	}
+	return body, nil
+}
+
+func closeFile(file *os.File) {
+	if err := file.Close(); err != nil {
+		warnf("Failed to close (%s): %+v", file.Name(), err)
+	}
+}
+
+// removeFile removes a bad download, so a retry doesn't see it as complete
+func removeFile(path string) {
+	if err := os.Remove(path); err != nil {
+		warnf("Failed to remove (%s): %+v", path, err)
+	}
+}
+
+// destinationPath returns the path of the file name in downloadDir, making sure it doesn't escape it
+func (d downloader) destinationPath(fileName string) (string, error) {
+	name, err := d.localName(fileName)
+	if err != nil {
+		return "", err
+	}
+
+	dir, err := filepath.Abs(d.downloadDir)
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, name)
+	if !strings.HasPrefix(path, dir+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid file name (%s): resolves outside of the download dir", fileName)
+	}
+
+	return filepath.Join(d.downloadDir, name), nil
+}
+
+// localName returns the relative path of the artifact title in downloadDir: its base name, or its cleaned path
+// with preservePaths. Both slashes and backslashes are path separators.
+func (d downloader) localName(title string) (string, error) {
+	slashed := strings.ReplaceAll(title, `\`, "/")
+	name := path.Base(slashed)
+	if d.preservePaths {
+		name = path.Clean(strings.TrimLeft(slashed, "/"))
+	}
+
+	if name == "" || name == "." || name == ".." || name == "/" || strings.HasPrefix(name, "../") {
+		return "", fmt.Errorf("invalid file name (%s)", title)
+	}
+	return filepath.FromSlash(name), nil
+}
+
+// sanitizeFileName replaces the path separators of an artifact title, so it can't write outside of the download dir
+func sanitizeFileName(name string) (string, error) {
+	sanitized := replaceSeparators(name)
+	if sanitized == "" || sanitized == "." || sanitized == ".." {
+		return "", fmt.Errorf("invalid file name (%s)", name)
+	}
+	return sanitized, nil
+}
+
+// replaceSeparators replaces the path separators of the name with underscores
+func replaceSeparators(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == filepath.Separator {
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+// fileNamePlaceholderPattern placeholders of FILENAME_TEMPLATE, like {title}
+var fileNamePlaceholderPattern = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// fileNamePlaceholders placeholders supported by FILENAME_TEMPLATE
+var fileNamePlaceholders = []string{"app_slug", "build_slug", "title", "artifact_type", "slug"}
+
+// validateFileNameTemplate returns an error when the template has an unknown placeholder
+func validateFileNameTemplate(template string) error {
+	for _, match := range fileNamePlaceholderPattern.FindAllStringSubmatch(template, -1) {
+		if !slices.Contains(fileNamePlaceholders, match[1]) {
+			return fmt.Errorf("invalid FILENAME_TEMPLATE (%s): unknown placeholder %s, expected {%s}", template, match[0], strings.Join(fileNamePlaceholders, "}, {"))
+		}
+	}
+	return nil
+}
+
+// templatedName returns the file name of the artifact expanded from fileNameTemplate, defaultName without template.
+// The path separators of the placeholder values are replaced, so a path-like title can't add directories.
+func (d downloader) templatedName(artifact ArtifactListItem, defaultName string) string {
+	if d.fileNameTemplate == "" {
+		return defaultName
+	}
+	values := map[string]string{
+		"app_slug":      d.appSlug,
+		"build_slug":    d.buildSlug,
+		"title":         artifact.Title,
+		"artifact_type": artifact.ArtifactType,
+		"slug":          artifact.Slug,
+	}
+	return fileNamePlaceholderPattern.ReplaceAllStringFunc(d.fileNameTemplate, func(placeholder string) string {
+		return replaceSeparators(values[strings.Trim(placeholder, "{}")])
+	})
+}
+
+// uniqueFileNames returns the local names of the artifacts, suffixing the colliding ones with a number
+func (d downloader) uniqueFileNames(artifacts []ArtifactListItem) []string {
+	used := map[string]bool{}
+	names := make([]string, len(artifacts))
+	for i, artifact := range artifacts {
+		name, err := d.localName(d.templatedName(artifact, artifact.Title))
+		if err != nil {
+			// left as is, the download reports the error
+			names[i] = artifact.Title
+			continue
+		}
+
+		// the names only collide within the same directory
+		dir := d.artifactDir(artifact)
+		ext := filepath.Ext(name)
+		base := strings.TrimSuffix(name, ext)
+		for n := 1; used[filepath.Join(dir, name)]; n++ {
+			name = fmt.Sprintf("%s-%d%s", base, n, ext)
+		}
+		used[filepath.Join(dir, name)] = true
+		names[i] = name
+	}
+	return names
+}
+
+// untypedDirName directory of the artifacts without type grouped by type
+const untypedDirName = "other"
+
+// artifactDir returns the directory downloadAll saves the artifact in, the subdirectory named after its type
+// with groupByType
+func (d downloader) artifactDir(artifact ArtifactListItem) string {
+	if !d.groupByType {
+		return d.downloadDir
+	}
+	name, err := sanitizeFileName(artifact.ArtifactType)
+	if err != nil {
+		name = untypedDirName
+	}
+	return filepath.Join(d.downloadDir, name)
+}
+
+// countByType returns the number of results of each artifact type, like "android-apk: 2, file: 1"
+func countByType(results []downloadResult) string {
+	counts := map[string]int{}
+	for _, result := range results {
+		counts[result.ArtifactType]++
+	}
+	types := make([]string, 0, len(counts))
+	for artifactType := range counts {
+		types = append(types, artifactType)
+	}
+	sort.Strings(types)
+
+	parts := make([]string, 0, len(types))
+	for _, artifactType := range types {
+		parts = append(parts, fmt.Sprintf("%s: %d", artifactType, counts[artifactType]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// downloadAll downloads every given artifact with up to concurrency parallel downloads,
+// a failed download does not stop the others unless failFast, the results of the successful ones are returned sorted by path
+func (d downloader) downloadAll(ctx context.Context, artifacts []ArtifactListItem) ([]downloadResult, error) {
+	concurrency := d.concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		mu                sync.Mutex
+		wg                sync.WaitGroup
+		total             int64
+		succeeded, failed []string
+		errs              []error
+		// aborted by the first failure with failFast
+		aborted bool
+		results = []downloadResult{}
+	)
+	fileNames := d.uniqueFileNames(artifacts)
+	if d.groupByType {
+		for _, artifact := range artifacts {
+			if err := os.MkdirAll(d.artifactDir(artifact), d.dirMode); err != nil {
+				return results, fmt.Errorf("failed to create the directory of the (%s) artifacts: %w", artifact.ArtifactType, err)
+			}
+		}
+	}
+	semaphore := make(chan struct{}, concurrency)
+	for i, artifact := range artifacts {
+		semaphore <- struct{}{}
+		mu.Lock()
+		stop := aborted
+		mu.Unlock()
+		if stop {
+			break
+		}
+
+		wg.Add(1)
+		go func(artifact ArtifactListItem, fileName string) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+
+			typed := d
+			typed.downloadDir = d.artifactDir(artifact)
+			result, err := typed.download(ctx, artifact, fileName)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if aborted {
+					// cancelled by the first failure
+					return
+				}
+				warnf("Failed to download (%s): %+v", artifact.Title, err)
+				failed = append(failed, fmt.Sprintf("%s: %+v", artifact.Title, err))
+				errs = append(errs, fmt.Errorf("(%s): %w", artifact.Title, err))
+				if d.failFast {
+					aborted = true
+					cancel()
+				}
+				return
+			}
+
+			switch {
+			case result.Skipped:
+				infof("%s: (%s) already exists, download skipped", artifact.Title, result.Path)
+			case result.NotModified:
+				infof("%s: (%s) not modified since the last download, existing file kept", artifact.Title, result.Path)
+			default:
+				infof("%s: [%d byte] downloaded in %s (%s), sha256: %s", artifact.Title, result.Bytes, time.Duration(result.DurationMs)*time.Millisecond, formatRate(result.AvgBytesPerSec), result.SHA256)
+			}
+			total += result.Bytes
+			succeeded = append(succeeded, artifact.Title)
+			results = append(results, result)
+		}(artifact, fileNames[i])
+	}
+	wg.Wait()
+
+	sort.Slice(results, func(i, j int) bool { return results[i].Path < results[j].Path })
+
+	infof("done, %d/%d artifacts [%d byte] downloaded", len(succeeded), len(artifacts), total)
+	if d.groupByType && len(results) > 0 {
+		infof("by type: %s", countByType(results))
+	}
+	if len(succeeded) > 0 {
+		infof("succeeded:\n  %s", strings.Join(succeeded, "\n  "))
+	}
+	if len(failed) > 0 {
+		infof("failed:\n  %s", strings.Join(failed, "\n  "))
+		if aborted {
+			return results, fmt.Errorf("FAIL_FAST stopped the downloads after a failure, %d of %d artifacts downloaded: %w", len(succeeded), len(artifacts), errs[0])
+		}
+		return results, fmt.Errorf("failed to download %d of %d artifacts: %w", len(failed), len(artifacts), errors.Join(errs...))
+	}
+
+	return results, nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// stdoutDownloader returns the downloader of the config targeting the api, and the details of its artifact
+func stdoutDownloader(t *testing.T, api *mockAPI, inputs map[string]string) (downloader, Artifact) {
+	t.Helper()
+	cfg := testConfig(t, api, inputs)
+	c, err := cfg.newClient()
+	if err != nil {
+		t.Fatalf("newClient: %v", err)
+	}
+	details, err := c.GetArtifactDetails("app", "build", "app.apk")
+	if err != nil {
+		t.Fatalf("GetArtifactDetails: %v", err)
+	}
+	return cfg.downloader(c, cfg.BuildSlug), details
+}
+
+func TestDownloadTo(t *testing.T) {
+	api := newMockAPI(t, map[string]string{"app.apk": "content"})
+	d, details := stdoutDownloader(t, api, nil)
+
+	var out bytes.Buffer
+	result, err := d.downloadTo(context.Background(), details, &out)
+	if err != nil {
+		t.Fatalf("downloadTo: %v", err)
+	}
+	if out.String() != "content" || result.Bytes != int64(len("content")) {
+		t.Errorf("got %q, %+v", out.String(), result)
+	}
+	if got := api.count("/v0.1/apps/app/builds/build/artifacts/app.apk"); got != 1 {
+		t.Errorf("details requests = %d, want the fetched details reused", got)
+	}
+}
+
+func TestDownloadToChecks(t *testing.T) {
+	tests := []struct {
+		name     string
+		inputs   map[string]string
+		details  func(*Artifact)
+		download http.HandlerFunc
+		check    func(error) bool
+	}{
+		{
+			name:   "max download bytes",
+			inputs: map[string]string{"MAX_DOWNLOAD_BYTES": "3"},
+			check: func(err error) bool {
+				return err != nil && strings.Contains(err.Error(), "exceeds the maximum download size")
+			},
+		},
+		{
+			name:    "max download bytes of an unknown size",
+			inputs:  map[string]string{"MAX_DOWNLOAD_BYTES": "3"},
+			details: func(details *Artifact) { details.Data.FileSizeBytes = 0 },
+			check: func(err error) bool {
+				return err != nil && strings.Contains(err.Error(), "exceeds the maximum download size")
+			},
+		},
+		{
+			name:    "checksum of the API",
+			details: func(details *Artifact) { details.Data.SHA256 = strings.Repeat("0", 64) },
+			check: func(err error) bool {
+				return err != nil && strings.Contains(err.Error(), "expected "+strings.Repeat("0", 64)+" from the API")
+			},
+		},
+		{
+			name: "HTML page",
+			download: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/html")
+				w.Write([]byte("content"))
+			},
+			check: func(err error) bool { return err != nil && strings.Contains(err.Error(), "served as text/html") },
+		},
+		{
+			name:   "stall",
+			inputs: map[string]string{"MIN_DOWNLOAD_BYTES_PER_SEC": "1000", "STALL_TIMEOUT_SEC": "1"},
+			download: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Length", "7")
+				w.Write([]byte("c"))
+				w.(http.Flusher).Flush()
+				<-r.Context().Done()
+			},
+			check: func(err error) bool { return errors.Is(err, errDownloadStalled) },
+		},
+		{
+			name: "expired url",
+			download: func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "Request has expired", http.StatusForbidden)
+			},
+			check: func(err error) bool {
+				var apiErr *APIError
+				return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusForbidden && !errors.Is(err, ErrUnauthorized) && exitCode(err) == exitCodeError
+			},
+		},
+		{
+			name:     "not found",
+			download: http.NotFound,
+			check: func(err error) bool {
+				var apiErr *APIError
+				return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound && exitCode(err) == exitCodeNotFound
+			},
+		},
+	}
+	for _, tt := range tests {
+		api := newMockAPI(t, map[string]string{"app.apk": "content"})
+		api.download = tt.download
+		d, details := stdoutDownloader(t, api, tt.inputs)
+		if tt.details != nil {
+			tt.details(&details)
+		}
+
+		_, err := d.downloadTo(context.Background(), details, &bytes.Buffer{})
+		if !tt.check(err) {
+			t.Errorf("%s: got %v", tt.name, err)
+		}
+	}
+}
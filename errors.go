@@ -0,0 +1,136 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ErrArtifactNotFound no artifact of the build matches the requested name
+var ErrArtifactNotFound = errors.New("artifact not found")
+
+// ErrNoArtifacts the build has no artifact at all, or none of the requested type
+var ErrNoArtifacts = errors.New("no artifacts")
+
+// ErrBuildNotFound no build of the app matches the requested criteria
+var ErrBuildNotFound = errors.New("build not found")
+
+// ErrDiskFull the disk of the download ran out of space
+var ErrDiskFull = errors.New("disk full")
+
+// ErrUnauthorized the API rejected the auth token, with a 401 or 403 status code
+var ErrUnauthorized = errors.New("unauthorized")
+
+// APIError Bitrise API call, or artifact download, answered with a non 2xx status code. The API errors match
+// ErrUnauthorized with errors.Is when the status code is 401 or 403.
+type APIError struct {
+	// Operation what the call was doing, e.g. "get artifacts"
+	Operation  string
+	StatusCode int
+	Endpoint   string
+	AppSlug    string
+	BuildSlug  string
+	// Body snippet of the response body, for diagnosis
+	Body string
+	// Download the response came from the host of the expiring download url, like a storage provider, which never
+	// sees the auth token: its 401 and 403, like an expired url, don't match ErrUnauthorized
+	Download bool
+}
+
+func (e *APIError) Error() string {
+	message := fmt.Sprintf("failed to %s with status code (%d) for [build_slug: %s, app_slug: %s]", e.Operation, e.StatusCode, e.BuildSlug, e.AppSlug)
+	if e.Body != "" {
+		message += fmt.Sprintf(", response: %s", e.Body)
+	}
+	return message
+}
+
+// maxBodySnippet maximum length in bytes of the response body snippets included in the errors
+const maxBodySnippet = 300
+
+// readBodySnippet returns a snippet of the response body, read up to a bounded length
+func readBodySnippet(resp *http.Response) string {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4*maxBodySnippet))
+	return bodySnippet(body)
+}
+
+// bodySnippet returns the body on a single line, without control characters and its whitespaces collapsed,
+// truncated to maxBodySnippet bytes
+func bodySnippet(body []byte) string {
+	cleaned := strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, strings.ToValidUTF8(string(body), ""))
+	snippet := strings.Join(strings.Fields(cleaned), " ")
+
+	if len(snippet) > maxBodySnippet {
+		cut := maxBodySnippet
+		for cut > 0 && !utf8.RuneStart(snippet[cut]) {
+			cut--
+		}
+		snippet = snippet[:cut] + "..."
+	}
+	return snippet
+}
+
+// Unwrap returns ErrUnauthorized when the API rejected the auth token, nil otherwise
+func (e *APIError) Unwrap() error {
+	if !e.Download && (e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden) {
+		return ErrUnauthorized
+	}
+	return nil
+}
+
+// errDiskFull returns the ErrDiskFull error of the download to path stopped after written bytes by the ENOSPC
+// error err, matching both with errors.Is
+func errDiskFull(path string, written int64, err error) error {
+	return fmt.Errorf("no space left on the device of (%s) after [%d byte] written, free some disk space: %w: %w", path, written, ErrDiskFull, err)
+}
+
+// sentinelError error with its own message, matching its sentinel with errors.Is
+type sentinelError struct {
+	message  string
+	sentinel error
+}
+
+func (e sentinelError) Error() string {
+	return e.message
+}
+
+func (e sentinelError) Unwrap() error {
+	return e.sentinel
+}
+
+// exit codes of the step, telling the automations wrapping it which failures are worth a retry
+const (
+	exitCodeError    = 1
+	exitCodeNotFound = 2
+	exitCodeAuth     = 3
+	exitCodeNetwork  = 4
+)
+
+// exitCode returns the exit code of the error: exitCodeNotFound when the build or the artifacts don't exist,
+// exitCodeAuth when the auth token is rejected, exitCodeNetwork on a network error, a stalled or timed out
+// download, or a 5xx or 429 status code, and exitCodeError otherwise
+func exitCode(err error) int {
+	var apiErr *APIError
+	switch {
+	case errors.Is(err, ErrArtifactNotFound) || errors.Is(err, ErrNoArtifacts) || errors.Is(err, ErrBuildNotFound):
+		return exitCodeNotFound
+	case errors.Is(err, ErrUnauthorized):
+		return exitCodeAuth
+	case errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound:
+		return exitCodeNotFound
+	case errors.As(err, &apiErr) && (apiErr.StatusCode >= 500 || apiErr.StatusCode == http.StatusTooManyRequests):
+		return exitCodeNetwork
+	case errors.Is(err, errDownloadStalled) || errors.Is(err, errAttemptTimeout) || isTransientReadError(err):
+		return exitCodeNetwork
+	}
+	return exitCodeError
+}
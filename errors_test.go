@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestErrDiskFull(t *testing.T) {
+	writeErr := &os.PathError{Op: "write", Path: "app.apk.part", Err: syscall.ENOSPC}
+	err := errDiskFull("app.apk", 1024, writeErr)
+
+	if !errors.Is(err, ErrDiskFull) || !errors.Is(err, syscall.ENOSPC) {
+		t.Errorf("errDiskFull() = %v, want it to match both ErrDiskFull and ENOSPC", err)
+	}
+	var pathErr *os.PathError
+	if !errors.As(err, &pathErr) || pathErr.Path != "app.apk.part" {
+		t.Errorf("errDiskFull() = %v, want it to wrap the write error", err)
+	}
+	if !strings.Contains(err.Error(), "(app.apk) after [1024 byte] written") {
+		t.Errorf("errDiskFull() = %q, want the path and the written bytes", err)
+	}
+}
+
+func TestAPIErrorUnauthorized(t *testing.T) {
+	tests := []struct {
+		name string
+		err  *APIError
+		want int
+	}{
+		{name: "API 401", err: &APIError{StatusCode: http.StatusUnauthorized}, want: exitCodeAuth},
+		{name: "API 403", err: &APIError{StatusCode: http.StatusForbidden}, want: exitCodeAuth},
+		{name: "download 403", err: &APIError{StatusCode: http.StatusForbidden, Download: true}, want: exitCodeError},
+		{name: "download 404", err: &APIError{StatusCode: http.StatusNotFound, Download: true}, want: exitCodeNotFound},
+		{name: "download 503", err: &APIError{StatusCode: http.StatusServiceUnavailable, Download: true}, want: exitCodeNetwork},
+	}
+	for _, tt := range tests {
+		if got := exitCode(tt.err); got != tt.want {
+			t.Errorf("%s: exitCode() = %d, want %d", tt.name, got, tt.want)
+		}
+		if got, want := errors.Is(tt.err, ErrUnauthorized), tt.want == exitCodeAuth; got != want {
+			t.Errorf("%s: errors.Is(ErrUnauthorized) = %t, want %t", tt.name, got, want)
+		}
+	}
+}
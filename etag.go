@@ -0,0 +1,32 @@
+package main
+
+import (
+	"os"
+	"strings"
+)
+
+// etagSuffix suffix of the file keeping the ETag of a download next to it, for USE_ETAG_CACHE
+const etagSuffix = ".etag"
+
+// readETag returns the ETag kept for the downloaded file, empty when there is none
+func readETag(path string) string {
+	content, err := os.ReadFile(path + etagSuffix)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(content))
+}
+
+// writeETag keeps the ETag of the downloaded file, or removes a stale one when the server sent none.
+// Failing to do so only costs a full download on the next run.
+func writeETag(path, etag string, mode os.FileMode) {
+	if etag == "" {
+		if err := os.Remove(path + etagSuffix); err != nil && !os.IsNotExist(err) {
+			debugf("failed to remove the ETag of (%s): %s", path, err)
+		}
+		return
+	}
+	if err := os.WriteFile(path+etagSuffix, []byte(etag+"\n"), mode); err != nil {
+		debugf("failed to write the ETag of (%s): %s", path, err)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDownloadNotModified(t *testing.T) {
+	api := newMockAPI(t, map[string]string{"app.apk": "content"})
+	api.download = func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte("content"))
+	}
+	cfg := testConfig(t, api, map[string]string{"USE_ETAG_CACHE": "true"})
+	c, err := cfg.newClient()
+	if err != nil {
+		t.Fatalf("newClient: %v", err)
+	}
+	d := cfg.downloader(c, cfg.BuildSlug)
+	artifact := ArtifactListItem{Slug: "app.apk", Title: "app.apk", FileSizeBytes: int64(len("content"))}
+
+	first, err := d.download(context.Background(), artifact, "app.apk")
+	if err != nil {
+		t.Fatalf("first download: %v", err)
+	}
+	if first.NotModified || first.Bytes != int64(len("content")) {
+		t.Errorf("first download: got %+v", first)
+	}
+
+	second, err := d.download(context.Background(), artifact, "app.apk")
+	if err != nil {
+		t.Fatalf("second download: %v", err)
+	}
+	if !second.NotModified || second.Skipped || second.Bytes != 0 || second.DownloadedAt != "" {
+		t.Errorf("second download: got %+v, want a not modified result without bytes", second)
+	}
+	if content, err := os.ReadFile(filepath.Join(cfg.DownloadDir, "app.apk")); err != nil || string(content) != "content" {
+		t.Errorf("existing file = %q, %v", content, err)
+	}
+}
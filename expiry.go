@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// expiryMargin an expiring download url expiring within it is refreshed before the download starts
+const expiryMargin = 30 * time.Second
+
+// signedDateLayout layout of the X-Amz-Date and X-Goog-Date query parameters
+const signedDateLayout = "20060102T150405Z"
+
+// ParseExpiry returns the expiry time of a signed url, from its S3 (X-Amz-Date and X-Amz-Expires),
+// GCS (X-Goog-Date and X-Goog-Expires) or Expires unix timestamp query parameters,
+// ok is false when the url carries none of them
+func ParseExpiry(rawURL string) (expiresAt time.Time, ok bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return time.Time{}, false
+	}
+	query := u.Query()
+
+	for _, prefix := range []string{"X-Amz-", "X-Goog-"} {
+		if expiresAt, ok := signedExpiry(query.Get(prefix+"Date"), query.Get(prefix+"Expires")); ok {
+			return expiresAt, true
+		}
+	}
+
+	if expires, err := strconv.ParseInt(query.Get("Expires"), 10, 64); err == nil && expires > 0 {
+		return time.Unix(expires, 0), true
+	}
+	return time.Time{}, false
+}
+
+// signedExpiry returns the signing date plus the validity in seconds
+func signedExpiry(date, expires string) (time.Time, bool) {
+	signedAt, err := time.Parse(signedDateLayout, date)
+	if err != nil {
+		return time.Time{}, false
+	}
+	seconds, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || seconds < 0 {
+		return time.Time{}, false
+	}
+	return signedAt.Add(time.Duration(seconds) * time.Second), true
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const zipSuffix = ".zip"
+
+// zipMagic signature starting the zip archives
+var zipMagic = []byte("PK\x03\x04")
+
+// zipPackageExtensions packages stored as zip archives but not meant to be extracted
+var zipPackageExtensions = []string{".apk", ".aab", ".ipa", ".jar"}
+
+// isZip reports whether the file is a zip archive, by extension or by content. The content of the packages
+// stored as zip archives, like the APKs and IPAs, is not sniffed: they are kept as is.
+func isZip(path, artifactType string) (bool, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == zipSuffix {
+		return true, nil
+	}
+	if slices.Contains(binaryArtifactTypes, artifactType) || slices.Contains(zipPackageExtensions, ext) {
+		return false, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer closeFile(file)
+
+	head := make([]byte, len(zipMagic))
+	if _, err := io.ReadFull(file, head); err != nil {
+		// too short to be a zip
+		return false, nil
+	}
+	return bytes.Equal(head, zipMagic), nil
+}
+
+// extractDir the directory a zip archive is extracted into, next to it and named after it without the .zip extension
+func extractDir(archivePath string) string {
+	if ext := filepath.Ext(archivePath); strings.EqualFold(ext, zipSuffix) {
+		return strings.TrimSuffix(archivePath, ext)
+	}
+	return archivePath + "-extracted"
+}
+
+// extractZip extracts the zip archive into destDir, returning the number of extracted files.
+// Entries escaping destDir (zip-slip) and symbolic links fail the extraction.
+func extractZip(archivePath, destDir string, dirMode, fileMode os.FileMode) (int, error) {
+	reader, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open the archive (%s): %w", archivePath, err)
+	}
+	defer func() {
+		if err := reader.Close(); err != nil {
+			warnf("Failed to close (%s): %+v", archivePath, err)
+		}
+	}()
+
+	if err := os.MkdirAll(destDir, dirMode); err != nil {
+		return 0, fmt.Errorf("failed to create the extraction directory: %w", err)
+	}
+
+	count := 0
+	for _, entry := range reader.File {
+		target, err := extractPath(destDir, entry.Name)
+		if err != nil {
+			return count, err
+		}
+
+		switch mode := entry.Mode(); {
+		case mode.IsDir():
+			if err := os.MkdirAll(target, dirMode); err != nil {
+				return count, err
+			}
+		case mode&os.ModeSymlink != 0:
+			return count, fmt.Errorf("archive entry (%s) is a symbolic link, refusing to extract it", entry.Name)
+		default:
+			if err := extractFile(entry, target, dirMode, fileMode); err != nil {
+				return count, err
+			}
+			count++
+		}
+	}
+	return count, nil
+}
+
+// extractPath returns the path of the archive entry in destDir, or an error when it escapes it
+func extractPath(destDir, name string) (string, error) {
+	target := filepath.Join(destDir, name)
+	rel, err := filepath.Rel(destDir, target)
+	if err != nil || filepath.IsAbs(name) || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("archive entry (%s) escapes the extraction directory", name)
+	}
+	return target, nil
+}
+
+func extractFile(entry *zip.File, target string, dirMode, fileMode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(target), dirMode); err != nil {
+		return err
+	}
+
+	src, err := entry.Open()
+	if err != nil {
+		return fmt.Errorf("failed to read the archive entry (%s): %w", entry.Name, err)
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, fileMode)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, src)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to extract the archive entry (%s): %w", entry.Name, err)
+	}
+	return nil
+}
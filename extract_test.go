@@ -0,0 +1,57 @@
+package main
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeZip writes an archive holding a single file at path
+func writeZip(t *testing.T, path string) {
+	t.Helper()
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeFile(file)
+	writer := zip.NewWriter(file)
+	entry, err := writer.Create("AndroidManifest.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := entry.Write([]byte("<manifest/>")); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIsZipSkipsPackages(t *testing.T) {
+	tests := []struct {
+		fileName     string
+		artifactType string
+		want         bool
+	}{
+		{fileName: "sources.zip", artifactType: "file", want: true},
+		{fileName: "sources", artifactType: "file", want: true},
+		{fileName: "app.apk", artifactType: "file", want: false},
+		{fileName: "app.aab", artifactType: "file", want: false},
+		{fileName: "App.IPA", artifactType: "file", want: false},
+		{fileName: "lib.jar", artifactType: "file", want: false},
+		{fileName: "app", artifactType: "android-apk", want: false},
+		{fileName: "app", artifactType: "ios-ipa", want: false},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), tt.fileName)
+		writeZip(t, path)
+		got, err := isZip(path, tt.artifactType)
+		if err != nil {
+			t.Fatalf("isZip(%s, %s): %v", tt.fileName, tt.artifactType, err)
+		}
+		if got != tt.want {
+			t.Errorf("isZip(%s, %s) = %t, want %t", tt.fileName, tt.artifactType, got, tt.want)
+		}
+	}
+}
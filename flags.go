@@ -0,0 +1,48 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+// flagEnvs maps the command line flags to the environment variables they override
+var flagEnvs = []struct {
+	name  string
+	env   string
+	usage string
+}{
+	{name: "token", env: "API_AUTH_TOKEN", usage: "Bitrise API auth token"},
+	{name: "app-slug", env: "APP_SLUG", usage: "app slug"},
+	{name: "build-slug", env: "WORKFLOW_SLUG_ID", usage: "build slug, the latest successful build when empty"},
+	{name: "artifact-name", env: "ARTIFACT_NAME", usage: "artifact name, glob pattern or comma-separated list of names"},
+	{name: "download-dir", env: "DOWNLOAD_DIR", usage: "download dir"},
+	{name: "config", env: configFileKey, usage: "JSON file of the step inputs, overridden by the env vars"},
+}
+
+// parseFlags parses the command line flags, the flags given override their environment variable
+func parseFlags(args []string) error {
+	flags := flag.NewFlagSet(args[0], flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage of %s:\n", args[0])
+		flags.PrintDefaults()
+		fmt.Fprintln(flags.Output(), "\nEvery input can also be set with its environment variable, the flags take precedence.")
+	}
+
+	for _, f := range flagEnvs {
+		flags.String(f.name, "", fmt.Sprintf("%s (env %s)", f.usage, f.env))
+	}
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	var err error
+	flags.Visit(func(f *flag.Flag) {
+		for _, fe := range flagEnvs {
+			if fe.name == f.Name && err == nil {
+				err = os.Setenv(fe.env, f.Value.String())
+			}
+		}
+	})
+	return err
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+)
+
+type logLevel int
+
+const (
+	levelDebug logLevel = iota
+	levelInfo
+	levelWarn
+	levelError
+)
+
+var logLevelNames = map[string]logLevel{
+	"debug": levelDebug,
+	"info":  levelInfo,
+	"warn":  levelWarn,
+	"error": levelError,
+}
+
+// minLogLevel messages below this level are not printed, set from LOG_LEVEL
+var minLogLevel = levelInfo
+
+// logOutput destination of the debug and info messages
+var logOutput io.Writer = os.Stdout
+
+// setLogLevel sets the minimum printed level from its name, an unknown name keeps the current one
+func setLogLevel(name string) {
+	if name == "" {
+		return
+	}
+
+	level, ok := logLevelNames[strings.ToLower(name)]
+	if !ok {
+		warnf("Invalid log level (%s), using info", name)
+		return
+	}
+	minLogLevel = level
+}
+
+// logf prints the message when its level is enabled, debug and info to logOutput, warn and error to stderr
+func logf(level logLevel, format string, v ...interface{}) {
+	if level < minLogLevel {
+		return
+	}
+
+	w := logOutput
+	prefix := ""
+	switch level {
+	case levelDebug:
+		prefix = "[debug] "
+	case levelWarn:
+		w, prefix = os.Stderr, " [!] "
+	case levelError:
+		w, prefix = os.Stderr, "Error: "
+	}
+	fmt.Fprintf(w, prefix+format+"\n", v...)
+}
+
+func debugf(format string, v ...interface{}) {
+	logf(levelDebug, format, v...)
+}
+
+func infof(format string, v ...interface{}) {
+	logf(levelInfo, format, v...)
+}
+
+func warnf(format string, v ...interface{}) {
+	logf(levelWarn, format, v...)
+}
+
+func errorf(format string, v ...interface{}) {
+	logf(levelError, format, v...)
+}
+
+// maskSecret masks all but the last 4 characters of a secret, so it can be logged
+func maskSecret(secret string) string {
+	const visible = 4
+	if len(secret) <= visible {
+		return strings.Repeat("*", len(secret))
+	}
+	return strings.Repeat("*", len(secret)-visible) + secret[len(secret)-visible:]
+}
+
+// redactURL removes the credentials and the query string, which holds the signature of the
+// expiring download urls, from the url so it can be logged
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "[redacted]"
+	}
+
+	u.User = nil
+	if u.RawQuery != "" {
+		u.RawQuery = "[redacted]"
+	}
+	return u.String()
+}
+
+// redactURLError redacts the url of the *url.Error returned by the http client, which would otherwise
+// expose the signed download url in the error messages
+func redactURLError(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		urlErr.URL = redactURL(urlErr.URL)
+	}
+	return err
+}
@@ -1,37 +1,133 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"math/rand"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/tabwriter"
 	"time"
 )
 
 const domain = "https://api.bitrise.io"
+
+// version of the step, sent in the User-Agent header, can be set at build time with
+// -ldflags "-X main.version=<version>"
+var version = "0.0.1"
+
+const userAgentName = "bitrise-step-artefact-download"
+
+// downloadAllName ARTIFACT_NAME value selecting every artifact of the build
+const downloadAllName = "*"
+
+// nameListSeparator separator of the ARTIFACT_NAME list of names
+const nameListSeparator = ","
 const apiVersion = "v0.1"
+const defaultAPITimeout = 20 * time.Second
+
+// defaultDownloadTimeout zero means no timeout, large artifacts can legitimately take minutes to download
+const defaultDownloadTimeout = 0
+
+const defaultDownloadConcurrency = 4
+
+const defaultOutputPathKey = "ARTEFACT_PATH"
+
+const defaultDirMode os.FileMode = 0755
+const defaultFileMode os.FileMode = 0644
+
+// stdoutDownloadDir DOWNLOAD_DIR value writing the downloaded artifact to stdout
+const stdoutDownloadDir = "-"
+
+// outputFormatJSON OUTPUT_FORMAT value printing machine-readable JSON
+const outputFormatJSON = "json"
+
+const defaultMaxRetries = 3
+
+// defaultDownloadMaxRetries number of new attempts of a failed download
+const defaultDownloadMaxRetries = 2
+
+// defaultResumeRetries number of times a download interrupted mid-stream is resumed with a Range request
+const defaultResumeRetries = 3
+const retryBaseDelay = 1 * time.Second
+
+// maxRetryDelay cap of the exponential delay between two retries, before the jitter
+const maxRetryDelay = 30 * time.Second
 
-// Client Bitrise API client
+// maxRetryCount upper bound of the API_MAX_RETRIES, DOWNLOAD_MAX_RETRIES and DOWNLOAD_RESUME_RETRIES inputs
+const maxRetryCount = 10
+
+const maxDownloadRedirects = 10
+
+// maxExpiredURLRetries number of fresh expiring download urls fetched when the download host rejects one
+const maxExpiredURLRetries = 2
+
+// maxRateLimitWait caps the total time spent waiting on 429 responses of a single request
+const maxRateLimitWait = 2 * time.Minute
+
+// defaultAuthScheme scheme of the Authorization header of the API requests
+const defaultAuthScheme = "token"
+
+// Doer sends an HTTP request and returns its response, implemented by *http.Client
+type Doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// Client Bitrise API client, safe for concurrent use by multiple goroutines: its methods have value receivers
+// and keep the request-scoped state, like headers and urls, local to each call
 type Client struct {
-	authToken  string
-	httpClient http.Client
+	authToken      string
+	baseURL        string
+	httpClient     http.Client
+	downloadClient http.Client
+	maxRetries     int
+	userAgent      string
+	// headers extra headers of the API requests, applied before the Authorization one so they can't override it
+	headers http.Header
+	// listingCacheTTL how long an artifacts listing cached on disk is reused, zero disables the cache
+	listingCacheTTL time.Duration
+	// headCheck checks the expiring download url with a HEAD request before the download
+	headCheck bool
+	// doer when set, sends both the API and the download requests instead of the http clients
+	doer Doer
+	// authScheme scheme of the Authorization header, like token or Bearer
+	authScheme string
+	// pageLimit when positive, number of artifacts requested per listing page with the limit query parameter
+	pageLimit int
+	// maxArtifacts when positive, the artifacts listing stops once it holds this many artifacts
+	maxArtifacts int
+}
+
+// ArtifactListItem ...
+type ArtifactListItem struct {
+	ArtifactType        string `json:"artifact_type"`
+	FileSizeBytes       int64  `json:"file_size_bytes"`
+	IsPublicPageEnabled bool   `json:"is_public_page_enabled"`
+	Slug                string `json:"slug"`
+	Title               string `json:"title"`
+	// CreatedAt RFC3339 creation time, empty when the API doesn't provide it
+	CreatedAt string `json:"created_at,omitempty"`
+}
+
+// Paging ...
+type Paging struct {
+	PageItemLimit  int    `json:"page_item_limit"`
+	TotalItemCount int    `json:"total_item_count"`
+	Next           string `json:"next"`
 }
 
 // Artifacts ...
 type Artifacts struct {
-	Data []struct {
-		ArtifactType        string `json:"artifact_type"`
-		IsPublicPageEnabled bool   `json:"is_public_page_enabled"`
-		Slug                string `json:"slug"`
-		Title               string `json:"title"`
-	} `json:"data"`
-	Paging struct {
-		PageItemLimit  int `json:"page_item_limit"`
-		TotalItemCount int `json:"total_item_count"`
-	} `json:"paging"`
+	Data   []ArtifactListItem `json:"data"`
+	Paging Paging             `json:"paging"`
 }
 
 // Artifact ...
@@ -39,89 +135,552 @@ type Artifact struct {
 	Data struct {
 		ArtifactType         string `json:"artifact_type"`
 		ExpiringDownloadURL  string `json:"expiring_download_url"`
+		FileSizeBytes        int64  `json:"file_size_bytes"`
 		IsPublicPageEnabled  bool   `json:"is_public_page_enabled"`
 		PublicInstallPageURL string `json:"public_install_page_url"`
 		Slug                 string `json:"slug"`
 		Title                string `json:"title"`
+		// SHA256 hex digest of the file, empty when the API doesn't report it
+		SHA256 string `json:"sha256,omitempty"`
 	} `json:"data"`
+	// ExpiresAt expiry time of the expiring download url, zero when the url doesn't tell
+	ExpiresAt time.Time `json:"-"`
 }
 
 // New Create new Bitrise API client
 func New(authToken string) Client {
+	return NewWithOptions(authToken)
+}
+
+// NewWithTimeout Create new Bitrise API client, the timeout covers the entire API request including reading
+// the response body, the artifact downloads have no timeout
+func NewWithTimeout(authToken string, timeout time.Duration) Client {
+	return NewWithTimeouts(authToken, timeout, defaultDownloadTimeout)
+}
+
+// NewWithTimeouts Create new Bitrise API client with separate timeouts for the API calls and the artifact download,
+// each timeout covers the entire request including reading the response body, zero means no timeout
+func NewWithTimeouts(authToken string, apiTimeout, downloadTimeout time.Duration) Client {
+	transport := newTransport(nil, nil)
 	return Client{
-		authToken:  authToken,
-		httpClient: http.Client{Timeout: 20 * time.Second},
+		authToken:      authToken,
+		baseURL:        domain,
+		httpClient:     http.Client{Timeout: apiTimeout, Transport: transport},
+		downloadClient: http.Client{Timeout: downloadTimeout, Transport: transport, CheckRedirect: checkDownloadRedirect},
+		maxRetries:     defaultMaxRetries,
+		userAgent:      userAgent(),
+		authScheme:     defaultAuthScheme,
+	}
+}
+
+// apiDoer returns the doer of the API requests
+func (c Client) apiDoer() Doer {
+	if c.doer != nil {
+		return c.doer
+	}
+	return &c.httpClient
+}
+
+// downloadDoer returns the doer of the download requests
+func (c Client) downloadDoer() Doer {
+	if c.doer != nil {
+		return c.doer
+	}
+	return &c.downloadClient
+}
+
+// get retries network errors and 5xx responses with exponential backoff, and 429 responses after the delay
+// requested by the Retry-After header, up to maxRetries times
+func (c Client) get(ctx context.Context, endpoint string) (*http.Response, error) {
+	defer timings.track(phaseAPI, time.Now())
+	url := fmt.Sprintf("%s/%s/%s", c.baseURL, apiVersion, endpoint)
+	rateLimitWait := time.Duration(0)
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+		if err != nil {
+			return &http.Response{}, fmt.Errorf("failed to create the request to (%s): %w", endpoint, err)
+		}
+		req.Header.Set("User-Agent", c.userAgent)
+		for key, values := range c.headers {
+			req.Header[key] = values
+		}
+		req.Header.Set("Authorization", fmt.Sprintf("%s %s", c.authScheme, c.authToken))
+
+		debugf("GET %s (Authorization: %s %s)", url, c.authScheme, maskSecret(c.authToken))
+		resp, err := c.apiDoer().Do(req)
+		if err == nil {
+			debugf("GET %s: status code (%d)", url, resp.StatusCode)
+		}
+		if attempt >= c.maxRetries {
+			if err != nil {
+				err = fmt.Errorf("request to (%s) failed: %w", endpoint, friendlyNetworkError(req.URL.Host, err))
+			}
+			return resp, err
+		}
+
+		var reason string
+		var delay time.Duration
+		switch {
+		case err != nil:
+			reason = err.Error()
+			delay = backoff(attempt)
+		case resp.StatusCode == http.StatusTooManyRequests:
+			delay = retryAfter(resp.Header.Get("Retry-After"), backoff(attempt))
+			if rateLimitWait+delay > maxRateLimitWait {
+				return resp, err
+			}
+			rateLimitWait += delay
+			reason = "rate limit exceeded"
+			responseBodyCloser(resp)
+		case resp.StatusCode >= 500:
+			reason = fmt.Sprintf("status code (%d)", resp.StatusCode)
+			delay = backoff(attempt)
+			responseBodyCloser(resp)
+		default:
+			return resp, err
+		}
+
+		warnf("Request to (%s) failed with %s, retrying in %s (%d/%d)", endpoint, reason, delay, attempt+1, c.maxRetries)
+		if err := sleepCtx(ctx, delay); err != nil {
+			return nil, fmt.Errorf("request to (%s) interrupted: %w", endpoint, err)
+		}
+	}
+}
+
+func userAgent() string {
+	return fmt.Sprintf("%s/%s", userAgentName, version)
+}
+
+// sleepCtx pauses for the given duration, returning early with the context error if it gets cancelled
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// backoff returns the exponential delay of the given attempt, capped by maxRetryDelay, with a random jitter
+// of up to the same amount
+func backoff(attempt int) time.Duration {
+	delay := retryBaseDelay
+	for i := 0; i < attempt && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	delay = min(delay, maxRetryDelay)
+	return delay + time.Duration(rand.Int63n(int64(delay)))
+}
+
+// retryAfter parses a Retry-After header value, given either in seconds or as an HTTP-date
+func retryAfter(value string, defaultDelay time.Duration) time.Duration {
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if delay := time.Until(date); delay > 0 {
+			return delay
+		}
+		return 0
+	}
+	return defaultDelay
+}
+
+// VerifyAuth checks the auth token with the lightweight me endpoint, returning an ErrUnauthorized error
+// when the API rejects it
+func (c Client) VerifyAuth() error {
+	return c.VerifyAuthCtx(context.Background())
+}
+
+// VerifyAuthCtx is VerifyAuth with a cancellable context
+func (c Client) VerifyAuthCtx(ctx context.Context) error {
+	requestPath := "me"
+
+	resp, err := c.get(ctx, requestPath)
+	if err != nil {
+		return err
+	}
+	defer responseBodyCloser(resp)
+
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return sentinelError{
+			message:  fmt.Sprintf("invalid auth token (%s): rejected with status code (%d)", maskSecret(c.authToken), resp.StatusCode),
+			sentinel: ErrUnauthorized,
+		}
+	}
+	if resp.StatusCode >= 300 || resp.StatusCode < 200 {
+		return &APIError{Operation: "verify auth", StatusCode: resp.StatusCode, Endpoint: requestPath, Body: readBodySnippet(resp)}
+	}
+	return nil
+}
+
+// GetArtifactsForBuild returns every artifact of the build, following the paging cursor until all pages are consumed,
+// or the first maxArtifacts ones when set, or the cached listing when the listing cache is enabled and fresh
+func (c Client) GetArtifactsForBuild(appSlug, buildSlug string) (Artifacts, error) {
+	return c.GetArtifactsForBuildCtx(context.Background(), appSlug, buildSlug)
+}
+
+// GetArtifactsForBuildCtx is GetArtifactsForBuild with a cancellable context
+func (c Client) GetArtifactsForBuildCtx(ctx context.Context, appSlug, buildSlug string) (art Artifacts, err error) {
+	if c.listingCacheTTL <= 0 {
+		return c.getAllArtifacts(ctx, appSlug, buildSlug, "")
+	}
+
+	if cached, ok := c.readListingCache(appSlug, buildSlug); ok {
+		cached.Data = c.capArtifacts(cached.Data)
+		return cached, nil
+	}
+	art, err = c.getAllArtifacts(ctx, appSlug, buildSlug, "")
+	// a capped listing is incomplete, it is never cached
+	if err == nil && (c.maxArtifacts <= 0 || len(art.Data) < c.maxArtifacts) {
+		c.writeListingCache(appSlug, buildSlug, art)
 	}
+	return
 }
 
-func (c Client) get(endpoint string) (*http.Response, error) {
-	url := fmt.Sprintf("%s/%s/%s", domain, apiVersion, endpoint)
-	req, err := http.NewRequest("GET", url, nil)
+// GetArtifactsForBuildOfType returns the artifacts of the build having the artifact type, every artifact
+// when it is empty. The type is sent as the artifact_type query parameter to reduce the listing, and the
+// artifacts are filtered again on the client side in case the API ignores it.
+func (c Client) GetArtifactsForBuildOfType(appSlug, buildSlug, artifactType string) (Artifacts, error) {
+	return c.GetArtifactsForBuildOfTypeCtx(context.Background(), appSlug, buildSlug, artifactType)
+}
+
+// GetArtifactsForBuildOfTypeCtx is GetArtifactsForBuildOfType with a cancellable context
+func (c Client) GetArtifactsForBuildOfTypeCtx(ctx context.Context, appSlug, buildSlug, artifactType string) (art Artifacts, err error) {
+	if artifactType == "" {
+		return c.GetArtifactsForBuildCtx(ctx, appSlug, buildSlug)
+	}
+
+	// a fresh cached listing of the whole build saves the request, a filtered one is never cached
+	if c.listingCacheTTL > 0 {
+		if cached, ok := c.readListingCache(appSlug, buildSlug); ok {
+			cached.Data = c.capArtifacts(filterByType(cached.Data, artifactType))
+			return cached, nil
+		}
+	}
+
+	art, err = c.getAllArtifacts(ctx, appSlug, buildSlug, artifactType)
 	if err != nil {
-		return &http.Response{}, err
+		return
+	}
+	art.Data = filterByType(art.Data, artifactType)
+	return
+}
+
+func (c Client) getAllArtifacts(ctx context.Context, appSlug, buildSlug, artifactType string) (art Artifacts, err error) {
+	defer timings.track(phaseList, time.Now())
+	next := ""
+	seen := map[string]bool{}
+	for {
+		var page Artifacts
+		page, err = c.getArtifactsPage(ctx, appSlug, buildSlug, artifactType, next, len(art.Data))
+		if err != nil {
+			return
+		}
+
+		art.Data = append(art.Data, page.Data...)
+		art.Paging = page.Paging
+
+		if c.maxArtifacts > 0 && len(art.Data) >= c.maxArtifacts {
+			if len(art.Data) > c.maxArtifacts || page.Paging.Next != "" {
+				infof("listing of build (%s) stopped at %d artifacts", buildSlug, c.maxArtifacts)
+			}
+			art.Data = art.Data[:c.maxArtifacts]
+			return
+		}
+		if page.Paging.Next == "" {
+			return
+		}
+		if err = checkNextPage(fmt.Sprintf("artifacts of build (%s)", buildSlug), seen, page.Paging.Next, len(page.Data)); err != nil {
+			return
+		}
+		next = page.Paging.Next
 	}
-	req.Header.Add("Authorization", fmt.Sprintf("token %s", c.authToken))
+}
 
-	resp, err := c.httpClient.Do(req)
-	return resp, err
+// checkNextPage returns an error when following the paging cursor next would not make progress: after an empty page,
+// or to a page already requested, which would otherwise list forever. seen records the requested cursors.
+func checkNextPage(what string, seen map[string]bool, next string, items int) error {
+	switch {
+	case items == 0:
+		return fmt.Errorf("invalid paging of the %s: empty page with a next cursor (%s)", what, next)
+	case seen[next]:
+		return fmt.Errorf("invalid paging of the %s: next cursor (%s) repeated", what, next)
+	}
+	seen[next] = true
+	return nil
+}
+
+// capArtifacts returns the first maxArtifacts artifacts, all of them when it is not set
+func (c Client) capArtifacts(artifacts []ArtifactListItem) []ArtifactListItem {
+	if c.maxArtifacts > 0 && len(artifacts) > c.maxArtifacts {
+		return artifacts[:c.maxArtifacts]
+	}
+	return artifacts
 }
 
-// GetArtifactsForBuild ...
-func (c Client) GetArtifactsForBuild(appSlug, buildSlug string) (art Artifacts, err error) {
+// getArtifactsPage returns a page of the artifacts listing, of up to pageLimit artifacts and no more than
+// the maxArtifacts left after the listed ones
+func (c Client) getArtifactsPage(ctx context.Context, appSlug, buildSlug, artifactType, next string, listed int) (art Artifacts, err error) {
 	requestPath := fmt.Sprintf("apps/%s/builds/%s/artifacts", appSlug, buildSlug)
+	query := url.Values{}
+	limit := c.pageLimit
+	if remaining := c.maxArtifacts - listed; c.maxArtifacts > 0 && (limit <= 0 || remaining < limit) {
+		limit = remaining
+	}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	if artifactType != "" {
+		query.Set("artifact_type", artifactType)
+	}
+	if next != "" {
+		query.Set("next", next)
+	}
+	if len(query) > 0 {
+		requestPath += "?" + query.Encode()
+	}
 
-	resp, err := c.get(requestPath)
+	resp, err := c.get(ctx, requestPath)
 	if err != nil {
 		return
 	}
 	defer responseBodyCloser(resp)
 
 	if resp.StatusCode >= 300 || resp.StatusCode < 200 {
-		err = fmt.Errorf("failed to get artifacts with status code (%d) for [build_slug: %s, app_slug: %s]", resp.StatusCode, appSlug, buildSlug)
+		err = &APIError{Operation: "get artifacts", StatusCode: resp.StatusCode, Endpoint: requestPath, AppSlug: appSlug, BuildSlug: buildSlug, Body: readBodySnippet(resp)}
 		return
 	}
 
-	err = json.NewDecoder(resp.Body).Decode(&art)
+	err = decodeJSON(resp, requestPath, &art)
 	return
 }
 
 // GetArtifactDetails ...
-func (c Client) GetArtifactDetails(appSlug, buildSlug, artifactSlug string) (art Artifact, err error) {
+func (c Client) GetArtifactDetails(appSlug, buildSlug, artifactSlug string) (Artifact, error) {
+	return c.GetArtifactDetailsCtx(context.Background(), appSlug, buildSlug, artifactSlug)
+}
+
+// GetArtifactDetailsCtx is GetArtifactDetails with a cancellable context
+func (c Client) GetArtifactDetailsCtx(ctx context.Context, appSlug, buildSlug, artifactSlug string) (art Artifact, err error) {
+	defer timings.track(phaseDetails, time.Now())
 	requestPath := fmt.Sprintf("apps/%s/builds/%s/artifacts/%s", appSlug, buildSlug, artifactSlug)
 
-	resp, err := c.get(requestPath)
+	resp, err := c.get(ctx, requestPath)
 	if err != nil {
 		return
 	}
 	defer responseBodyCloser(resp)
 
 	if resp.StatusCode >= 300 || resp.StatusCode < 200 {
-		err = fmt.Errorf("failed to get artifact details with status code (%d) for [build_slug: %s, app_slug: %s]", resp.StatusCode, appSlug, buildSlug)
+		err = &APIError{Operation: "get artifact details", StatusCode: resp.StatusCode, Endpoint: requestPath, AppSlug: appSlug, BuildSlug: buildSlug, Body: readBodySnippet(resp)}
 		return
 	}
 
-	err = json.NewDecoder(resp.Body).Decode(&art)
+	if err = decodeJSON(resp, requestPath, &art); err != nil {
+		return
+	}
+	art.ExpiresAt, _ = ParseExpiry(art.Data.ExpiringDownloadURL)
 	return
 }
 
-// DownloadArtifact ...
+// GetArtifactByName returns the details of the build artifact with the given title, or an ErrArtifactNotFound error
+func (c Client) GetArtifactByName(appSlug, buildSlug, title string) (Artifact, error) {
+	return c.GetArtifactByNameCtx(context.Background(), appSlug, buildSlug, title)
+}
+
+// GetArtifactByNameCtx is GetArtifactByName with a cancellable context
+func (c Client) GetArtifactByNameCtx(ctx context.Context, appSlug, buildSlug, title string) (Artifact, error) {
+	artifacts, err := c.GetArtifactsForBuildCtx(ctx, appSlug, buildSlug)
+	if err != nil {
+		return Artifact{}, err
+	}
+
+	if len(artifacts.Data) == 0 {
+		return Artifact{}, errNoArtifacts(buildSlug, "")
+	}
+
+	for _, artifact := range artifacts.Data {
+		if artifact.Title == title {
+			return c.GetArtifactDetailsCtx(ctx, appSlug, buildSlug, artifact.Slug)
+		}
+	}
+	return Artifact{}, errArtifactNotFound(title, artifacts.Data)
+}
+
+// DownloadArtifact returns the content of the artifact, the caller must close it, even when reading it fails.
+// Nothing needs to be closed when an error is returned. DownloadArtifactTo closes it on its own.
 func (c Client) DownloadArtifact(appSlug, buildSlug, artifactSlug string) (io.ReadCloser, error) {
-	artifact, err := c.GetArtifactDetails(appSlug, buildSlug, artifactSlug)
+	return c.DownloadArtifactCtx(context.Background(), appSlug, buildSlug, artifactSlug)
+}
+
+// DownloadArtifactCtx is DownloadArtifact with a cancellable context, cancelling it also interrupts reading the returned body
+func (c Client) DownloadArtifactCtx(ctx context.Context, appSlug, buildSlug, artifactSlug string) (io.ReadCloser, error) {
+	artifact, err := c.GetArtifactDetailsCtx(ctx, appSlug, buildSlug, artifactSlug)
 	if err != nil {
 		return nil, err
 	}
 
-	resp, err := http.Get(artifact.Data.ExpiringDownloadURL)
+	resp, artifact, err := c.openDownloadRefreshing(ctx, appSlug, buildSlug, artifact, 0, "")
 	if err != nil {
 		return nil, err
 	}
+	if resp.StatusCode >= 300 || resp.StatusCode < 200 {
+		responseBodyCloser(resp)
+		return nil, fmt.Errorf("failed to download (%s) with status code (%d)", artifact.Data.Title, resp.StatusCode)
+	}
 
 	return resp.Body, nil
 }
 
+// DownloadArtifactTo copies the content of the artifact into w, returning the number of bytes written,
+// the download is closed before returning
+func (c Client) DownloadArtifactTo(appSlug, buildSlug, artifactSlug string, w io.Writer) (int64, error) {
+	return c.DownloadArtifactToCtx(context.Background(), appSlug, buildSlug, artifactSlug, w)
+}
+
+// DownloadArtifactToCtx is DownloadArtifactTo with a cancellable context
+func (c Client) DownloadArtifactToCtx(ctx context.Context, appSlug, buildSlug, artifactSlug string, w io.Writer) (int64, error) {
+	body, err := c.DownloadArtifactCtx(ctx, appSlug, buildSlug, artifactSlug)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err := body.Close(); err != nil {
+			warnf("Failed to close response body: %+v", err)
+		}
+	}()
+
+	return io.Copy(w, body)
+}
+
+// openDownloadRefreshing is openDownload fetching a fresh expiring download url and retrying, up to
+// maxExpiredURLRetries times, when the download host rejects the url as expired with a 403 status code.
+// The artifact details holding the url actually used are returned with the response.
+// A url already expired, or expiring within expiryMargin, is refreshed first.
+// With the HEAD check enabled, the url is first checked with a HEAD request, failing early on a non 2xx status code,
+// and the Content-Length of its response is returned as the artifact size when the API doesn't provide it.
+// With an etag, the download is conditional and the server answers 304 Not Modified when the file still has it.
+func (c Client) openDownloadRefreshing(ctx context.Context, appSlug, buildSlug string, artifact Artifact, offset int64, etag string) (*http.Response, Artifact, error) {
+	if !artifact.ExpiresAt.IsZero() && time.Until(artifact.ExpiresAt) < expiryMargin {
+		warnf("Download url of (%s) expires at %s, fetching a fresh one", artifact.Data.Title, artifact.ExpiresAt.Format(time.RFC3339))
+		var err error
+		if artifact, err = c.GetArtifactDetailsCtx(ctx, appSlug, buildSlug, artifact.Data.Slug); err != nil {
+			return nil, artifact, err
+		}
+	}
+
+	if c.headCheck {
+		resp, checked, err := c.requestDownloadRefreshing(ctx, http.MethodHead, appSlug, buildSlug, artifact, 0, "")
+		if err != nil {
+			return nil, checked, err
+		}
+		responseBodyCloser(resp)
+
+		if resp.StatusCode >= 300 || resp.StatusCode < 200 {
+			return nil, checked, fmt.Errorf("download url of (%s) failed the HEAD check with status code (%d)", checked.Data.Title, resp.StatusCode)
+		}
+		if checked.Data.FileSizeBytes <= 0 && resp.ContentLength > 0 {
+			debugf("size of (%s) from the HEAD check: %d byte", checked.Data.Title, resp.ContentLength)
+			checked.Data.FileSizeBytes = resp.ContentLength
+		}
+		artifact = checked
+	}
+
+	return c.requestDownloadRefreshing(ctx, http.MethodGet, appSlug, buildSlug, artifact, offset, etag)
+}
+
+func (c Client) requestDownloadRefreshing(ctx context.Context, method, appSlug, buildSlug string, artifact Artifact, offset int64, etag string) (*http.Response, Artifact, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := c.openDownload(ctx, method, artifact, offset, etag)
+		if err != nil || resp.StatusCode != http.StatusForbidden || attempt >= maxExpiredURLRetries {
+			return resp, artifact, err
+		}
+		responseBodyCloser(resp)
+
+		warnf("Download url of (%s) rejected with status code (%d), fetching a fresh one (%d/%d)", artifact.Data.Title, resp.StatusCode, attempt+1, maxExpiredURLRetries)
+		size := artifact.Data.FileSizeBytes
+		if artifact, err = c.GetArtifactDetailsCtx(ctx, appSlug, buildSlug, artifact.Data.Slug); err != nil {
+			return nil, artifact, err
+		}
+		if artifact.Data.FileSizeBytes <= 0 {
+			// keep the size learnt from the HEAD check
+			artifact.Data.FileSizeBytes = size
+		}
+	}
+}
+
+// openDownload starts the download of the artifact from its expiring download url, from the given byte offset
+// when positive, in which case the server answers 206 Partial Content if it supports range requests,
+// and only when its ETag differs from etag when not empty
+func (c Client) openDownload(ctx context.Context, method string, artifact Artifact, offset int64, etag string) (*http.Response, error) {
+	return c.openURL(ctx, method, artifact.Data.ExpiringDownloadURL, offset, etag)
+}
+
+// openURL requests the expiring url with the download client, from the given byte offset when positive,
+// with an If-None-Match header when etag is not empty
+func (c Client) openURL(ctx context.Context, method, rawURL string, offset int64, etag string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, nil)
+	if err != nil {
+		return nil, redactURLError(err)
+	}
+	req.Header.Set("User-Agent", c.userAgent)
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	debugf("%s %s", method, redactURL(rawURL))
+	resp, err := c.downloadDoer().Do(req)
+	if err != nil {
+		return nil, friendlyNetworkError(req.URL.Host, redactURLError(err))
+	}
+	debugf("%s %s: status code (%d)", method, redactURL(rawURL), resp.StatusCode)
+	return resp, nil
+}
+
+// checkDownloadRedirect limits the redirects of the download to maxDownloadRedirects, and makes sure
+// no Authorization header is forwarded to another host, like a storage provider
+func checkDownloadRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxDownloadRedirects {
+		return fmt.Errorf("download redirect limit (%d) exceeded", maxDownloadRedirects)
+	}
+
+	debugf("download redirected to %s", redactURL(req.URL.String()))
+	if req.URL.Host != via[0].URL.Host {
+		req.Header.Del("Authorization")
+	}
+	return nil
+}
+
+// PublicInstallPageURL returns the public install page url of the artifact, ok is false when its public page is not enabled
+func (artifact Artifact) PublicInstallPageURL() (url string, ok bool) {
+	if !artifact.Data.IsPublicPageEnabled || artifact.Data.PublicInstallPageURL == "" {
+		return "", false
+	}
+	return artifact.Data.PublicInstallPageURL, true
+}
+
+// decodeJSON decodes the JSON response body, an error includes a snippet of the body, like a gateway HTML page
+func decodeJSON(resp *http.Response, requestPath string, v interface{}) error {
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read the response of (%s): %w", requestPath, err)
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("failed to decode the response of (%s): %w, response: %s", requestPath, err, bodySnippet(body))
+	}
+	return nil
+}
+
 func responseBodyCloser(resp *http.Response) {
 	if err := resp.Body.Close(); err != nil {
-		log.Printf(" [!] Failed to close response body: %+v", err)
+		warnf("Failed to close response body: %+v", err)
 	}
 }
 
@@ -129,85 +688,731 @@ func errNoEnv(env string) error {
 	return fmt.Errorf("environment variable (%s) is not set", env)
 }
 
+// readTokenFile returns the trimmed content of the auth token file
+func readTokenFile(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read the auth token file (%s): %w", path, err)
+	}
+
+	token := strings.TrimSpace(string(b))
+	if token == "" {
+		return "", fmt.Errorf("auth token file (%s) is empty", path)
+	}
+	return token, nil
+}
+
 func mainE() error {
-	accessTokenKey := "API_AUTH_TOKEN"
-	accessToken := os.Getenv(accessTokenKey)
-	if accessToken == "" {
-		return errNoEnv(accessTokenKey)
+	env := os.Getenv
+	var file *configFile
+	if path := os.Getenv(configFileKey); path != "" {
+		var err error
+		if file, err = readConfigFile(path); err != nil {
+			return err
+		}
+		env = file.under(os.Getenv)
+	}
+
+	setLogLevel(env("LOG_LEVEL"))
+	if logsToStderr(env) {
+		logOutput = os.Stderr
+	}
+	if file != nil {
+		infof("using the inputs of the config file (%s), the env vars take precedence", file.path)
+	}
+	cfg, err := parseConfig(env)
+	if err != nil {
+		return err
+	}
+	if file != nil {
+		file.warnUnused()
+	}
+
+	if cfg.Timings || minLogLevel == levelDebug {
+		start := time.Now()
+		defer func() { timings.print(time.Since(start)) }()
+	}
+
+	c, err := cfg.newClient()
+	if err != nil {
+		return err
+	}
+	return run(cfg, c)
+}
+
+// run selects and downloads the artifacts configured by cfg with the client
+func run(cfg Config, c Client) (err error) {
+	ctx := context.Background()
+	if operationTimeout := cfg.OperationTimeout; operationTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, operationTimeout)
+		defer cancel()
+		defer func() {
+			if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				err = fmt.Errorf("operation timed out after %s (OPERATION_TIMEOUT_SEC): %w", operationTimeout, err)
+			}
+		}()
+	}
+
+	if cfg.VerifyAuth {
+		if err := c.VerifyAuthCtx(ctx); err != nil {
+			return err
+		}
+		debugf("auth token verified")
+	}
+
+	filter := cfg.filter()
+	appSlug, buildSlug := cfg.AppSlug, cfg.BuildSlug
+	if buildSlug == "" && len(cfg.BuildSlugs) == 0 && cfg.ScanBuilds > 0 {
+		found, err := c.findNewestBuild(ctx, appSlug, cfg.Branch, describeSelection(filter), cfg.ScanBuilds, selectionMatches(filter))
+		if err != nil {
+			return err
+		}
+		buildSlug = found.Build.Slug
+		infof("using the newest successful build with matching artifacts #%d (%s)", found.Build.BuildNumber, buildSlug)
 	}
 
-	appSlugKey := "APP_SLUG"
-	appSlug := os.Getenv(appSlugKey)
-	if appSlug == "" {
-		return errNoEnv(appSlugKey)
+	if buildSlug == "" && len(cfg.BuildSlugs) == 0 {
+		build, err := c.GetLatestSuccessfulBuildCtx(ctx, appSlug, cfg.Branch)
+		if err != nil {
+			return err
+		}
+		buildSlug = build.Slug
+		infof("using the latest successful build #%d (%s)", build.BuildNumber, buildSlug)
+	}
+
+	if cfg.ExportBuildInfo {
+		buildSlugs := cfg.BuildSlugs
+		if len(buildSlugs) == 0 {
+			buildSlugs = []string{buildSlug}
+		}
+		if err := exportBuilds(ctx, c, appSlug, buildSlugs); err != nil {
+			return err
+		}
 	}
 
-	buildSlugKey := "WORKFLOW_SLUG_ID"
-	buildSlug := os.Getenv(buildSlugKey)
-	if buildSlug == "" {
-		return errNoEnv(buildSlugKey)
+	d := cfg.downloader(c, buildSlug)
+
+	if len(cfg.BuildSlugs) > 0 {
+		if cfg.DryRun || cfg.ListOnly || cfg.PrintDownloadURLs || cfg.ArtifactSlug != "" || cfg.toStdout() {
+			return fmt.Errorf("BUILD_SLUGS can't be combined with DRY_RUN, LIST_ONLY, PRINT_DOWNLOAD_URLS, ARTIFACT_SLUG or a (%s) DOWNLOAD_DIR", stdoutDownloadDir)
+		}
+		// the manifest is written there even when every build fails
+		if err := os.MkdirAll(d.downloadDir, d.dirMode); err != nil {
+			return fmt.Errorf("failed to create the download directory: %w", err)
+		}
+		results, downloadErr := d.downloadBuilds(ctx, cfg.BuildSlugs, filter)
+		// the download error is kept when reporting the results fails too
+		if cfg.OutputFormat == outputFormatJSON {
+			if err := printJSON(results); err != nil {
+				return errors.Join(downloadErr, err)
+			}
+		}
+		if err := exportResults(cfg.OutputPathKey, results); err != nil {
+			return errors.Join(downloadErr, err)
+		}
+		if err := writeManifest(cfg.ManifestPath, results, cfg.FileMode); err != nil {
+			return errors.Join(downloadErr, err)
+		}
+		return downloadErr
 	}
 
-	artifactNameKey := "ARTIFACT_NAME"
-	artifactName := os.Getenv(artifactNameKey)
-	if artifactName == "" {
-		return errNoEnv(artifactNameKey)
+	if d.includeBuildLog && !cfg.DryRun && !cfg.ListOnly && !cfg.PrintDownloadURLs && !cfg.toStdout() {
+		if err := os.MkdirAll(d.downloadDir, d.dirMode); err != nil {
+			return fmt.Errorf("failed to create the download directory: %w", err)
+		}
+		if _, err := d.downloadBuildLog(ctx); err != nil {
+			return err
+		}
 	}
 
-	downloadDirKey := "DOWNLOAD_DIR"
-	downloadDir := os.Getenv(downloadDirKey)
-	if downloadDir == "" {
-		downloadDir = "."
+	if cfg.ArtifactSlug != "" {
+		details, err := c.GetArtifactDetailsCtx(ctx, appSlug, buildSlug, cfg.ArtifactSlug)
+		if err != nil {
+			return err
+		}
+
+		if cfg.DryRun {
+			infof("dry run, 1 artifacts selected")
+			printArtifactDetails(details)
+			return nil
+		}
+
+		if cfg.PrintDownloadURLs {
+			item := ArtifactListItem{Slug: details.Data.Slug, Title: details.Data.Title}
+			return printDownloadURLs(ctx, c, appSlug, buildSlug, []ArtifactListItem{item})
+		}
+
+		if cfg.toStdout() {
+			return reportStdoutDownload(d.downloadTo(ctx, details, os.Stdout))
+		}
+
+		if err := os.MkdirAll(d.downloadDir, d.dirMode); err != nil {
+			return fmt.Errorf("failed to create the download directory: %w", err)
+		}
+
+		fileName := details.Data.Title
+		if cfg.ArtifactName != "" && !isGlob(cfg.ArtifactName) {
+			fileName = cfg.ArtifactName
+		}
+
+		item := ArtifactListItem{Slug: details.Data.Slug, Title: details.Data.Title, ArtifactType: details.Data.ArtifactType}
+		result, err := d.downloadWithDetails(ctx, item, d.templatedName(item, fileName), &details)
+		if err != nil {
+			return err
+		}
+		if err := writeManifest(cfg.ManifestPath, []downloadResult{result}, cfg.FileMode); err != nil {
+			return err
+		}
+		return reportDownload(result, cfg.OutputPathKey, cfg.OutputFormat)
 	}
 
-	if err := os.MkdirAll(downloadDir, os.ModePerm); err != nil {
+	var artifacts Artifacts
+	if cfg.WaitForArtifacts {
+		artifacts, err = c.waitForArtifacts(ctx, appSlug, buildSlug, cfg.ArtifactType, cfg.WaitTimeout, cfg.WaitPollInterval, selectionMatches(filter))
+	} else {
+		artifacts, err = c.GetArtifactsForBuildOfTypeCtx(ctx, appSlug, buildSlug, cfg.ArtifactType)
+	}
+	if err != nil {
 		return err
 	}
 
-	c := New(accessToken)
-	artifacts, err := c.GetArtifactsForBuild(appSlug, buildSlug)
+	if cfg.ListOnly {
+		return printArtifacts(artifacts.Data, cfg.OutputFormat)
+	}
+
+	if len(artifacts.Data) == 0 {
+		downloadAll := cfg.ArtifactNameRegex == nil && (cfg.ArtifactName == "" || cfg.ArtifactName == downloadAllName)
+		if downloadAll && !cfg.FailOnNoArtifacts {
+			infof("build (%s) has no artifacts, nothing to download", buildSlug)
+			return nil
+		}
+		return errNoArtifacts(buildSlug, cfg.ArtifactType)
+	}
+
+	selected, err := selectArtifacts(artifacts.Data, filter)
 	if err != nil {
 		return err
 	}
+	if selected, err = refineSelection(selected, filter); err != nil {
+		return err
+	}
 
-	artifactSlugMap := map[string]string{}
-	for _, artifact := range artifacts.Data {
-		artifactSlugMap[artifact.Title] = artifact.Slug
+	if cfg.DryRun {
+		if err := printDryRun(ctx, c, appSlug, buildSlug, selected.artifacts); err != nil {
+			return err
+		}
+		return errMissingArtifacts(selected.missing)
+	}
+
+	if cfg.PrintDownloadURLs {
+		if err := printDownloadURLs(ctx, c, appSlug, buildSlug, selected.artifacts); err != nil {
+			return err
+		}
+		return errMissingArtifacts(selected.missing)
+	}
+
+	if cfg.toStdout() {
+		if len(selected.artifacts) != 1 {
+			return fmt.Errorf("DOWNLOAD_DIR (%s) writes a single artifact to stdout, %d artifacts selected", stdoutDownloadDir, len(selected.artifacts))
+		}
+		artifact := selected.artifacts[0]
+		details, err := c.GetArtifactDetailsCtx(ctx, appSlug, buildSlug, artifact.Slug)
+		if err != nil {
+			return err
+		}
+		if details.Data.ArtifactType == "" {
+			details.Data.ArtifactType = artifact.ArtifactType
+		}
+		return reportStdoutDownload(d.downloadTo(ctx, details, os.Stdout))
+	}
+
+	if err := os.MkdirAll(d.downloadDir, d.dirMode); err != nil {
+		return fmt.Errorf("failed to create the download directory: %w", err)
+	}
+
+	if !selected.multiple {
+		result, err := d.download(ctx, selected.artifacts[0], d.templatedName(selected.artifacts[0], selected.artifacts[0].Title))
+		if err != nil {
+			return err
+		}
+		if err := writeManifest(cfg.ManifestPath, []downloadResult{result}, cfg.FileMode); err != nil {
+			return err
+		}
+		return reportDownload(result, cfg.OutputPathKey, cfg.OutputFormat)
+	}
+
+	results, downloadErr := d.downloadAll(ctx, selected.artifacts)
+	downloadErr = errors.Join(downloadErr, errMissingArtifacts(selected.missing))
+	// the download error is kept when reporting the results fails too
+	if cfg.OutputFormat == outputFormatJSON {
+		if err := printJSON(results); err != nil {
+			return errors.Join(downloadErr, err)
+		}
+	}
+	if err := exportResults(cfg.OutputPathKey, results); err != nil {
+		return errors.Join(downloadErr, err)
 	}
+	if err := writeManifest(cfg.ManifestPath, results, cfg.FileMode); err != nil {
+		return errors.Join(downloadErr, err)
+	}
+	return downloadErr
+}
 
-	artifactSlug, exists := artifactSlugMap[artifactName]
-	if !exists {
-		keys, err := json.MarshalIndent(artifactSlugMap, "", "  ")
+// exportBuilds exports the number and commit hash of the builds, in the order of their slugs
+func exportBuilds(ctx context.Context, c Client, appSlug string, buildSlugs []string) error {
+	builds := make([]Build, 0, len(buildSlugs))
+	for _, buildSlug := range buildSlugs {
+		build, err := c.GetBuildCtx(ctx, appSlug, buildSlug)
 		if err != nil {
 			return err
 		}
-		return fmt.Errorf("unable to find artifact with name (%s), available artifacts:\n%s", artifactName, string(keys))
+		builds = append(builds, build)
+	}
+	return exportBuildInfo(builds)
+}
+
+// errMissingArtifacts returns an ErrArtifactNotFound error listing the names matching no artifact, nil when there is none
+func errMissingArtifacts(missing []string) error {
+	if len(missing) == 0 {
+		return nil
+	}
+	return sentinelError{
+		message:  fmt.Sprintf("unable to find artifacts with names (%s)", strings.Join(missing, ", ")),
+		sentinel: ErrArtifactNotFound,
+	}
+}
+
+// reportDownload prints and exports the result of a single artifact download
+func reportDownload(result downloadResult, outputPathKey, outputFormat string) error {
+	if outputFormat == outputFormatJSON {
+		if err := printJSON(result); err != nil {
+			return err
+		}
+	} else if result.Skipped {
+		infof("done, (%s) already exists, download skipped", result.Path)
+	} else if result.NotModified {
+		infof("done, (%s) not modified since the last download, existing file kept", result.Path)
+	} else {
+		infof("done, [%d byte] downloaded in %s (%s)", result.Bytes, time.Duration(result.DurationMs)*time.Millisecond, formatRate(result.AvgBytesPerSec))
+		infof("sha256: %s", result.SHA256)
 	}
 
-	reader, err := c.DownloadArtifact(appSlug, buildSlug, artifactSlug)
+	return exportResults(outputPathKey, []downloadResult{result})
+}
+
+// reportStdoutDownload logs the result of a download written to stdout, nothing is exported without a file
+func reportStdoutDownload(result downloadResult, err error) error {
 	if err != nil {
 		return err
 	}
+	infof("done, [%d byte] written to stdout in %s (%s)", result.Bytes, time.Duration(result.DurationMs)*time.Millisecond, formatRate(result.AvgBytesPerSec))
+	infof("sha256: %s", result.SHA256)
+	return nil
+}
+
+// printArtifacts prints the artifacts as a table, or as JSON with the json output format
+func printArtifacts(artifacts []ArtifactListItem, outputFormat string) error {
+	if outputFormat == outputFormatJSON {
+		return printJSON(artifacts)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TITLE\tSLUG\tTYPE\tSIZE")
+	for _, artifact := range artifacts {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\n", artifact.Title, artifact.Slug, artifact.ArtifactType, artifact.FileSizeBytes)
+	}
+	return w.Flush()
+}
+
+// printDryRun prints the selected artifacts with their download url, without downloading them
+func printDryRun(ctx context.Context, c Client, appSlug, buildSlug string, selected []ArtifactListItem) error {
+	infof("dry run, %d artifacts selected", len(selected))
+	for _, artifact := range selected {
+		details, err := c.GetArtifactDetailsCtx(ctx, appSlug, buildSlug, artifact.Slug)
+		if err != nil {
+			return err
+		}
+		printArtifactDetails(details)
+	}
+	return nil
+}
+
+func printArtifactDetails(details Artifact) {
+	infof("- title: %s\n  slug: %s\n  type: %s\n  download url: %s", details.Data.Title, details.Data.Slug, details.Data.ArtifactType, redactURL(details.Data.ExpiringDownloadURL))
+}
+
+// artifactFilter criteria selecting the artifacts of a build
+type artifactFilter struct {
+	// artifactType any type when empty
+	artifactType string
+	// name exact name, glob pattern or comma-separated list of them, ignored when regex is set
+	name  string
+	regex *regexp.Regexp
+	// matchNormalize falls back to the name matched case and whitespace insensitively
+	matchNormalize     bool
+	requireSingleMatch bool
+	includeExtensions  []string
+	excludeExtensions  []string
+	// order selectNewest or selectOldest picks a single artifact among several selected ones
+	order string
+}
+
+// selection artifacts selected for download
+type selection struct {
+	artifacts []ArtifactListItem
+	// multiple is false when a single artifact is selected by exact name match
+	multiple bool
+	// missing names of a name list matching no artifact
+	missing []string
+}
+
+// selectNewest and selectOldest values of SELECT, picking a single artifact among several selected ones by creation time
+const (
+	selectNewest = "newest"
+	selectOldest = "oldest"
+)
+
+// refineSelection narrows a multiple selection with narrowSelection, then fails when it still
+// holds several artifacts with requireSingleMatch
+func refineSelection(selected selection, filter artifactFilter) (selection, error) {
+	selected = narrowSelection(selected, filter)
+	if filter.requireSingleMatch && len(selected.artifacts) > 1 {
+		return selected, errSeveralMatches(selected.artifacts)
+	}
+	return selected, nil
+}
 
-	file, err := os.Create(filepath.Join(downloadDir, artifactName))
+// errSeveralMatches returns the REQUIRE_SINGLE_MATCH error listing the matching artifacts
+func errSeveralMatches(artifacts []ArtifactListItem) error {
+	matches := make([]string, 0, len(artifacts))
+	for _, artifact := range artifacts {
+		matches = append(matches, fmt.Sprintf("(%s) [slug: %s]", artifact.Title, artifact.Slug))
+	}
+	return fmt.Errorf("%d artifacts match, REQUIRE_SINGLE_MATCH expects exactly one: %s", len(artifacts), strings.Join(matches, ", "))
+}
+
+// narrowSelection narrows a multiple selection to the included and not excluded extensions of the filter,
+// then to its newest or oldest artifact by the filter order
+func narrowSelection(selected selection, filter artifactFilter) selection {
+	if !selected.multiple {
+		return selected
+	}
+	selected.artifacts = filterExtensions(selected.artifacts, filter.includeExtensions, filter.excludeExtensions)
+	if filter.order == "" || len(selected.artifacts) == 0 {
+		return selected
+	}
+
+	artifact := pickByCreationTime(selected.artifacts, filter.order == selectNewest)
+	infof("%s artifact selected among %d: %s", filter.order, len(selected.artifacts), artifact.Title)
+	selected.artifacts = []ArtifactListItem{artifact}
+	selected.multiple = false
+	return selected
+}
+
+// pickByCreationTime returns the newest, or oldest, artifact, falling back to the first listed one
+// when any creation time is missing or invalid
+func pickByCreationTime(artifacts []ArtifactListItem, newest bool) ArtifactListItem {
+	picked, pickedAt := artifacts[0], time.Time{}
+	for i, artifact := range artifacts {
+		createdAt, err := parseCreatedAt(artifact.CreatedAt)
+		if err != nil {
+			warnf("Invalid or missing created_at of (%s), selecting the first listed artifact: %s", artifact.Title, err)
+			return artifacts[0]
+		}
+		if i == 0 || (newest && createdAt.After(pickedAt)) || (!newest && createdAt.Before(pickedAt)) {
+			picked, pickedAt = artifact, createdAt
+		}
+	}
+	return picked
+}
+
+// parseCreatedAt parses an RFC3339 timestamp, with or without fractional seconds
+func parseCreatedAt(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, errors.New("empty timestamp")
+	}
+	return time.Parse(time.RFC3339Nano, strings.TrimSpace(value))
+}
+
+// selectionMatches returns whether the selection of the artifacts by the filter matches every requested name
+func selectionMatches(filter artifactFilter) func(Artifacts) bool {
+	return func(artifacts Artifacts) bool {
+		selected, err := selectArtifacts(artifacts.Data, filter)
+		return err == nil && len(selected.artifacts) > 0 && len(selected.missing) == 0
+	}
+}
+
+// describeSelection describes the artifacts selected by the type, the name and the regex of the filter, for the errors
+func describeSelection(filter artifactFilter) string {
+	var criteria []string
+	if filter.regex != nil {
+		criteria = append(criteria, fmt.Sprintf("regex: %s", filter.regex))
+	} else if filter.name != "" && filter.name != downloadAllName {
+		criteria = append(criteria, fmt.Sprintf("name: %s", filter.name))
+	}
+	if filter.artifactType != "" {
+		criteria = append(criteria, fmt.Sprintf("type: %s", filter.artifactType))
+	}
+	if len(criteria) == 0 {
+		return "[any]"
+	}
+	return fmt.Sprintf("[%s]", strings.Join(criteria, ", "))
+}
+
+// selectArtifacts returns the artifacts of the filter type (any type when empty) selected by the filter regex,
+// or else by the filter name, which can be a comma-separated list of names
+func selectArtifacts(all []ArtifactListItem, filter artifactFilter) (selection, error) {
+	artifacts := all
+	if filter.artifactType != "" {
+		artifacts = filterByType(all, filter.artifactType)
+	}
+
+	if filter.regex != nil {
+		matches := matchRegex(artifacts, filter.regex)
+		if len(matches) == 0 {
+			return selection{}, errArtifactNotFound(filter.regex.String(), all)
+		}
+		return selection{artifacts: matches, multiple: true}, nil
+	}
+
+	if filter.name == "" || filter.name == downloadAllName {
+		return selection{artifacts: artifacts, multiple: true}, nil
+	}
+
+	if strings.Contains(filter.name, nameListSeparator) {
+		return selectNameList(all, artifacts, filter)
+	}
+
+	matches, err := matchName(artifacts, filter.name, filter)
 	if err != nil {
-		return err
+		return selection{}, err
+	}
+	if len(matches) == 0 {
+		return selection{}, errArtifactNotFound(filter.name, all)
+	}
+	return selection{artifacts: matches, multiple: isGlob(filter.name)}, nil
+}
+
+// selectNameList selects the artifacts matching any name of the comma-separated list of the filter
+func selectNameList(all, artifacts []ArtifactListItem, filter artifactFilter) (selection, error) {
+	var selected selection
+	selected.multiple = true
+	seen := map[string]bool{}
+	for _, name := range strings.Split(filter.name, nameListSeparator) {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		matches, err := matchName(artifacts, name, filter)
+		if err != nil {
+			return selection{}, err
+		}
+		if len(matches) == 0 {
+			infof("%s: not found", name)
+			selected.missing = append(selected.missing, name)
+			continue
+		}
+
+		infof("%s: matched", name)
+		for _, artifact := range matches {
+			if !seen[artifact.Slug] {
+				seen[artifact.Slug] = true
+				selected.artifacts = append(selected.artifacts, artifact)
+			}
+		}
+	}
+
+	if len(selected.artifacts) == 0 {
+		return selection{}, errArtifactNotFound(filter.name, all)
+	}
+	return selected, nil
+}
+
+// matchName returns the artifacts matching the glob pattern, or the artifact with the exact name,
+// the newest one when several artifacts share the name, with the single match and normalization settings of the filter
+func matchName(artifacts []ArtifactListItem, name string, filter artifactFilter) ([]ArtifactListItem, error) {
+	if isGlob(name) {
+		return matchGlob(artifacts, name)
+	}
+
+	var matches []ArtifactListItem
+	for _, artifact := range artifacts {
+		if artifact.Title == name {
+			matches = append(matches, artifact)
+		}
+	}
+
+	if len(matches) > 1 && filter.requireSingleMatch {
+		return nil, errSeveralMatches(matches)
+	}
+	if len(matches) > 1 {
+		slugs := make([]string, 0, len(matches))
+		for _, artifact := range matches {
+			slugs = append(slugs, fmt.Sprintf("(%s)", artifact.Slug))
+		}
+		artifact := pickByCreationTime(matches, true)
+		warnf("%d artifacts are named (%s), with slugs %s, selecting the newest (%s), set ARTIFACT_SLUG to pick another one",
+			len(matches), name, strings.Join(slugs, ", "), artifact.Slug)
+		return []ArtifactListItem{artifact}, nil
 	}
-	n, err := io.Copy(file, reader)
+	if len(matches) == 1 {
+		return matches, nil
+	}
+	if filter.matchNormalize {
+		return matchNormalized(artifacts, name)
+	}
+	return nil, nil
+}
+
+// matchNormalized returns the artifact whose title matches the name once both are normalized,
+// or an error listing the titles when several match
+func matchNormalized(artifacts []ArtifactListItem, name string) ([]ArtifactListItem, error) {
+	normalized := normalizeName(name)
+	var matches []ArtifactListItem
+	var titles []string
+	for _, artifact := range artifacts {
+		if normalizeName(artifact.Title) == normalized {
+			matches = append(matches, artifact)
+			titles = append(titles, fmt.Sprintf("(%s)", artifact.Title))
+		}
+	}
+
+	if len(matches) > 1 {
+		return nil, fmt.Errorf("artifact name (%s) is ambiguous once normalized, matching: %s", name, strings.Join(titles, ", "))
+	}
+	return matches, nil
+}
+
+// normalizeName trims, collapses the internal whitespaces and lowercases the name
+func normalizeName(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+func filterByType(artifacts []ArtifactListItem, artifactType string) []ArtifactListItem {
+	var filtered []ArtifactListItem
+	for _, artifact := range artifacts {
+		if artifact.ArtifactType == artifactType {
+			filtered = append(filtered, artifact)
+		}
+	}
+	return filtered
+}
+
+// filterExtensions keeps the artifacts whose title ends with an included extension (any when none is given),
+// and not with an excluded one, exclusion wins on conflict. Extensions can span several dots, like .dSYM.zip.
+func filterExtensions(artifacts []ArtifactListItem, include, exclude []string) []ArtifactListItem {
+	if len(include) == 0 && len(exclude) == 0 {
+		return artifacts
+	}
+
+	var filtered []ArtifactListItem
+	for _, artifact := range artifacts {
+		if len(include) > 0 && !hasExtension(artifact.Title, include) {
+			continue
+		}
+		if hasExtension(artifact.Title, exclude) {
+			continue
+		}
+		filtered = append(filtered, artifact)
+	}
+	return filtered
+}
+
+func hasExtension(name string, extensions []string) bool {
+	name = strings.ToLower(name)
+	for _, ext := range extensions {
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		if strings.HasSuffix(name, strings.ToLower(ext)) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitList splits a comma-separated list, ignoring the empty items
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+type availableArtifact struct {
+	Slug         string `json:"slug"`
+	ArtifactType string `json:"artifact_type"`
+}
+
+// errNoArtifacts returns an ErrNoArtifacts error for the build, listed with the artifact type filter when set
+func errNoArtifacts(buildSlug, artifactType string) error {
+	message := fmt.Sprintf("build (%s) has no artifacts", buildSlug)
+	if artifactType != "" {
+		message = fmt.Sprintf("build (%s) has no artifacts of type (%s)", buildSlug, artifactType)
+	}
+	return sentinelError{message: message, sentinel: ErrNoArtifacts}
+}
+
+func errArtifactNotFound(artifactName string, artifacts []ArtifactListItem) error {
+	availableArtifacts := map[string]availableArtifact{}
+	for _, artifact := range artifacts {
+		availableArtifacts[artifact.Title] = availableArtifact{Slug: artifact.Slug, ArtifactType: artifact.ArtifactType}
+	}
+
+	keys, err := json.MarshalIndent(availableArtifacts, "", "  ")
 	if err != nil {
 		return err
 	}
+	return sentinelError{
+		message:  fmt.Sprintf("unable to find artifact with name (%s), available artifacts:\n%s", artifactName, string(keys)),
+		sentinel: ErrArtifactNotFound,
+	}
+}
 
-	fmt.Printf("done, [%d byte] downloaded\n", n)
+// isGlob reports whether the name contains any of the filepath.Match metacharacters
+func isGlob(name string) bool {
+	return strings.ContainsAny(name, `*?[\`)
+}
 
-	return nil
+func matchGlob(artifacts []ArtifactListItem, pattern string) ([]ArtifactListItem, error) {
+	var matches []ArtifactListItem
+	for _, artifact := range artifacts {
+		matched, err := filepath.Match(pattern, artifact.Title)
+		if err != nil {
+			return nil, fmt.Errorf("invalid artifact name pattern (%s): %w", pattern, err)
+		}
+		if matched {
+			matches = append(matches, artifact)
+		}
+	}
+	return matches, nil
+}
+
+func matchRegex(artifacts []ArtifactListItem, re *regexp.Regexp) []ArtifactListItem {
+	var matches []ArtifactListItem
+	for _, artifact := range artifacts {
+		if re.MatchString(artifact.Title) {
+			matches = append(matches, artifact)
+		}
+	}
+	return matches
 }
 
 func main() {
-	if err := mainE(); err != nil {
-		fmt.Printf("Error: %+v\n", err)
+	if err := parseFlags(os.Args); err != nil {
+		errorf("%+v", err)
 		os.Exit(1)
 	}
 
+	if err := mainE(); err != nil {
+		errorf("%+v", err)
+		os.Exit(exitCode(err))
+	}
+
 	os.Exit(0)
 }
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mockAPI Bitrise API serving the artifacts of the build "build" of the app "app", the content of each
+// artifact by title, its slug being its title
+type mockAPI struct {
+	*httptest.Server
+	contents map[string]string
+	// download serves the artifact downloads instead of their contents when set
+	download http.HandlerFunc
+
+	mu       sync.Mutex
+	requests map[string]int
+}
+
+func newMockAPI(t *testing.T, contents map[string]string) *mockAPI {
+	t.Helper()
+	api := &mockAPI{contents: contents, requests: map[string]int{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v0.1/apps/app/builds/build/artifacts", func(w http.ResponseWriter, r *http.Request) {
+		var items []string
+		for title, content := range contents {
+			items = append(items, fmt.Sprintf(`{"slug":%q,"title":%q,"artifact_type":"file","file_size_bytes":%d}`, title, title, len(content)))
+		}
+		fmt.Fprintf(w, `{"data":[%s],"paging":{}}`, strings.Join(items, ","))
+	})
+	mux.HandleFunc("/v0.1/apps/app/builds/build/artifacts/", func(w http.ResponseWriter, r *http.Request) {
+		slug := filepath.Base(r.URL.Path)
+		content, ok := contents[slug]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, `{"data":{"slug":%q,"title":%q,"artifact_type":"file","file_size_bytes":%d,"expiring_download_url":"%s/dl/%s"}}`,
+			slug, slug, len(content), api.URL, slug)
+	})
+	mux.HandleFunc("/dl/", func(w http.ResponseWriter, r *http.Request) {
+		if api.download != nil {
+			api.download(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		fmt.Fprint(w, contents[filepath.Base(r.URL.Path)])
+	})
+	api.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		api.mu.Lock()
+		api.requests[r.URL.Path]++
+		api.mu.Unlock()
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(api.Close)
+	return api
+}
+
+// count returns the number of requests to the path
+func (api *mockAPI) count(path string) int {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	return api.requests[path]
+}
+
+// testConfig returns the config of the inputs on top of the ones targeting the api
+func testConfig(t *testing.T, api *mockAPI, inputs map[string]string) Config {
+	t.Helper()
+	env := map[string]string{
+		"API_AUTH_TOKEN":       "token",
+		"APP_SLUG":             "app",
+		"WORKFLOW_SLUG_ID":     "build",
+		"BITRISE_API_BASE_URL": api.URL,
+		"NO_PROGRESS":          "true",
+		"DOWNLOAD_DIR":         t.TempDir(),
+	}
+	for key, value := range inputs {
+		env[key] = value
+	}
+	cfg, err := parseConfig(func(key string) string { return env[key] })
+	if err != nil {
+		t.Fatalf("parseConfig: %v", err)
+	}
+	return cfg
+}
+
+// runConfig runs the step with the config against its api
+func runConfig(t *testing.T, cfg Config) error {
+	t.Helper()
+	c, err := cfg.newClient()
+	if err != nil {
+		t.Fatalf("newClient: %v", err)
+	}
+	return run(cfg, c)
+}
+
+func TestRunArtifactSlugFetchesDetailsOnce(t *testing.T) {
+	api := newMockAPI(t, map[string]string{"app.apk": "content"})
+	cfg := testConfig(t, api, map[string]string{"ARTIFACT_SLUG": "app.apk"})
+
+	if err := runConfig(t, cfg); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if got := api.count("/v0.1/apps/app/builds/build/artifacts/app.apk"); got != 1 {
+		t.Errorf("details requests = %d, want 1", got)
+	}
+	content, err := os.ReadFile(filepath.Join(cfg.DownloadDir, "app.apk"))
+	if err != nil || string(content) != "content" {
+		t.Errorf("downloaded content = %q, %v", content, err)
+	}
+}
+
+func TestClientConcurrentListings(t *testing.T) {
+	// the listing cache is shared by the calls too
+	t.Setenv("TMPDIR", t.TempDir())
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "token secret" || r.Header.Get("X-Team") != "mobile" {
+			http.Error(w, "unexpected headers", http.StatusBadRequest)
+			return
+		}
+		// apps/app/builds/<build>/artifacts
+		build := strings.Split(r.URL.Path, "/")[5]
+		if r.URL.Query().Get("next") == "" {
+			fmt.Fprintf(w, `{"data":[{"slug":"%s-1","title":"%s-1.apk"}],"paging":{"next":"page-2"}}`, build, build)
+			return
+		}
+		fmt.Fprintf(w, `{"data":[{"slug":"%s-2","title":"%s-2.apk"}],"paging":{}}`, build, build)
+	}))
+	defer srv.Close()
+
+	c := NewWithOptions("secret", WithBaseURL(srv.URL), WithHeader("X-Team", "mobile"))
+	c.listingCacheTTL = time.Minute
+
+	const calls = 50
+	errs := make(chan error, calls)
+	var wg sync.WaitGroup
+	for i := 0; i < calls; i++ {
+		wg.Add(1)
+		go func(build string) {
+			defer wg.Done()
+			artifacts, err := c.GetArtifactsForBuildCtx(context.Background(), "app", build)
+			if err != nil {
+				errs <- fmt.Errorf("build (%s): %w", build, err)
+				return
+			}
+			if len(artifacts.Data) != 2 || artifacts.Data[0].Slug != build+"-1" || artifacts.Data[1].Slug != build+"-2" {
+				errs <- fmt.Errorf("build (%s): got the artifacts %+v", build, artifacts.Data)
+			}
+		}(fmt.Sprintf("build-%d", i%10))
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestRunBuildSlugsAllFailedWritesManifest(t *testing.T) {
+	api := newMockAPI(t, map[string]string{"app.apk": "content"})
+	downloadDir := filepath.Join(t.TempDir(), "artifacts")
+	cfg := testConfig(t, api, map[string]string{
+		"BUILD_SLUGS":   "missing",
+		"DOWNLOAD_DIR":  downloadDir,
+		"MANIFEST_FILE": "manifest.json",
+	})
+
+	err := runConfig(t, cfg)
+	if err == nil || !strings.Contains(err.Error(), "missing") {
+		t.Fatalf("run: got %v, want the error of the build (missing)", err)
+	}
+	if _, err := os.Stat(filepath.Join(downloadDir, "manifest.json")); err != nil {
+		t.Errorf("manifest not written: %v", err)
+	}
+}
+
+func TestPagingLoopStops(t *testing.T) {
+	tests := []struct {
+		name string
+		page func(next string) string
+	}{
+		{name: "repeated cursor", page: func(next string) string {
+			return fmt.Sprintf(`{"data":[{"slug":"item-%s"}],"paging":{"next":"same"}}`, next)
+		}},
+		{name: "empty page", page: func(next string) string {
+			return fmt.Sprintf(`{"data":[],"paging":{"next":"page-%s"}}`, next)
+		}},
+	}
+	for _, tt := range tests {
+		var requests int
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			fmt.Fprint(w, tt.page(r.URL.Query().Get("next")))
+		}))
+		c := NewWithOptions("token", WithBaseURL(srv.URL))
+
+		if _, err := c.GetArtifactsForBuild("app", "build"); err == nil || !strings.Contains(err.Error(), "invalid paging") {
+			t.Errorf("%s: artifacts listing got %v, want an invalid paging error", tt.name, err)
+		}
+		if _, err := c.getLatestBuilds(context.Background(), "app", 100); err == nil || !strings.Contains(err.Error(), "invalid paging") {
+			t.Errorf("%s: builds listing got %v, want an invalid paging error", tt.name, err)
+		}
+		if requests > 4 {
+			t.Errorf("%s: %d requests, want the listings to stop after 2 pages", tt.name, requests)
+		}
+		srv.Close()
+	}
+}
+
+func TestBackoffCapped(t *testing.T) {
+	for _, attempt := range []int{0, 5, 10, 33, 64, 1000} {
+		delay := backoff(attempt)
+		if delay < retryBaseDelay || delay >= 2*maxRetryDelay {
+			t.Errorf("backoff(%d) = %s, want between %s and %s", attempt, delay, retryBaseDelay, 2*maxRetryDelay)
+		}
+	}
+	if delay := backoff(10); delay < maxRetryDelay {
+		t.Errorf("backoff(10) = %s, want at least the cap %s", delay, maxRetryDelay)
+	}
+}
+
+func TestRunSingleBuildKeepsDownloadErrors(t *testing.T) {
+	api := newMockAPI(t, map[string]string{"a.apk": "content", "b.apk": "content"})
+	api.download = func(w http.ResponseWriter, r *http.Request) {
+		if filepath.Base(r.URL.Path) == "b.apk" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, "content")
+	}
+	cfg := testConfig(t, api, map[string]string{
+		"ARTIFACT_NAME": "a.apk,b.apk,missing.apk",
+		// no such directory, writing the manifest fails
+		"MANIFEST_FILE": filepath.Join("missing", "manifest.json"),
+	})
+
+	err := runConfig(t, cfg)
+	if err == nil {
+		t.Fatal("run: expected an error")
+	}
+	for _, want := range []string{"(b.apk)", "missing.apk", "failed to write the manifest"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("run: error %q does not contain %q", err, want)
+		}
+	}
+	if !errors.Is(err, ErrArtifactNotFound) {
+		t.Errorf("run: error %q does not match ErrArtifactNotFound", err)
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ClientOption configures the Client built by NewWithOptions
+type ClientOption func(*Client)
+
+// NewWithOptions Create new Bitrise API client with the default configuration changed by the options
+func NewWithOptions(authToken string, opts ...ClientOption) Client {
+	c := NewWithTimeouts(authToken, defaultAPITimeout, defaultDownloadTimeout)
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return c
+}
+
+// WithTimeout sets the timeout of the API calls, the artifact downloads are not limited by it
+func WithTimeout(timeout time.Duration) ClientOption {
+	return func(c *Client) {
+		c.httpClient.Timeout = timeout
+	}
+}
+
+// WithBaseURL sets the url of the Bitrise API, like https://api.bitrise.io
+func WithBaseURL(baseURL string) ClientOption {
+	return func(c *Client) {
+		c.baseURL = strings.TrimSuffix(baseURL, "/")
+	}
+}
+
+// WithHTTPClient sets the http client of the API calls, its transport is also used for the artifact downloads
+func WithHTTPClient(httpClient *http.Client) ClientOption {
+	return func(c *Client) {
+		c.httpClient = *httpClient
+		c.downloadClient.Transport = httpClient.Transport
+	}
+}
+
+// WithDoer sends both the API and the download requests with the doer, like a mock in tests,
+// the timeouts, transport and redirect policy of the default http clients then no longer apply
+func WithDoer(doer Doer) ClientOption {
+	return func(c *Client) {
+		c.doer = doer
+	}
+}
+
+// WithAuthScheme sets the scheme of the Authorization header, token by default, like Bearer for some proxies
+func WithAuthScheme(scheme string) ClientOption {
+	return func(c *Client) {
+		c.authScheme = scheme
+	}
+}
+
+// WithConnectionPool sizes the idle connection pool of the transport shared by the API calls and the downloads:
+// maxIdleConns across all hosts, maxIdleConnsPerHost per host and how long idle connections are kept.
+// It has no effect when the transport isn't an *http.Transport, nor with WithDoer.
+func WithConnectionPool(maxIdleConns, maxIdleConnsPerHost int, idleConnTimeout time.Duration) ClientOption {
+	return func(c *Client) {
+		transport, ok := c.httpClient.Transport.(*http.Transport)
+		if !ok {
+			return
+		}
+		transport = transport.Clone()
+		transport.MaxIdleConns = maxIdleConns
+		transport.MaxIdleConnsPerHost = maxIdleConnsPerHost
+		transport.IdleConnTimeout = idleConnTimeout
+		c.setTransport(transport)
+	}
+}
+
+// WithMaxRetries sets the number of retries of the failed API calls
+func WithMaxRetries(maxRetries int) ClientOption {
+	return func(c *Client) {
+		c.maxRetries = maxRetries
+	}
+}
+
+// WithHeader adds a header to every API request, the Authorization header of the auth token can't be overridden
+// and is skipped with a warning
+func WithHeader(key, value string) ClientOption {
+	return func(c *Client) {
+		if strings.EqualFold(key, "Authorization") {
+			warnf("Header (%s) can't be overridden, skipped", key)
+			return
+		}
+		// cloned so the clients sharing the previous headers are left unchanged
+		headers := c.headers.Clone()
+		if headers == nil {
+			headers = http.Header{}
+		}
+		headers.Add(key, value)
+		c.headers = headers
+	}
+}
+
+// WithPageLimit sets the number of artifacts requested per page of the artifacts listing, the API default when zero
+func WithPageLimit(limit int) ClientOption {
+	return func(c *Client) {
+		c.pageLimit = limit
+	}
+}
+
+// WithMaxArtifacts stops the artifacts listing once it holds maxArtifacts artifacts, saving the requests of the
+// next pages of the large builds, zero lists them all
+func WithMaxArtifacts(maxArtifacts int) ClientOption {
+	return func(c *Client) {
+		c.maxArtifacts = maxArtifacts
+	}
+}
+
+// WithUserAgent sets the User-Agent header of the requests
+func WithUserAgent(userAgent string) ClientOption {
+	return func(c *Client) {
+		c.userAgent = userAgent
+	}
+}
+
+// headerKeyPattern characters of a valid header name, or Authorization scheme
+var headerKeyPattern = regexp.MustCompile("^[A-Za-z0-9!#$%&'*+.^_`|~-]+$")
+
+// parseHeaders parses the semicolon-separated "Key: Value" headers of EXTRA_HEADERS
+func parseHeaders(list string) (http.Header, error) {
+	headers := http.Header{}
+	for _, item := range strings.Split(list, ";") {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+
+		key, value, ok := strings.Cut(item, ":")
+		key = strings.TrimSpace(key)
+		if !ok || !headerKeyPattern.MatchString(key) {
+			return nil, fmt.Errorf("invalid EXTRA_HEADERS header (%s): expected Key: Value", strings.TrimSpace(item))
+		}
+		if strings.EqualFold(key, "Authorization") {
+			return nil, fmt.Errorf("invalid EXTRA_HEADERS header (%s): the Authorization header is set from the auth token", key)
+		}
+		headers.Add(key, strings.TrimSpace(value))
+	}
+	return headers, nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// doerFunc Doer answering every request with the function
+type doerFunc func(req *http.Request) (*http.Response, error)
+
+func (f doerFunc) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// respond returns a Doer answering every request with the status code and the body
+func respond(statusCode int, body string) Doer {
+	return doerFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: statusCode, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(body)), Request: req}, nil
+	})
+}
+
+func TestWithDoerAPIError(t *testing.T) {
+	tests := []struct {
+		name         string
+		statusCode   int
+		body         string
+		unauthorized bool
+	}{
+		{name: "not found", statusCode: http.StatusNotFound, body: `{"message":"Not Found"}`},
+		{name: "unauthorized", statusCode: http.StatusUnauthorized, body: `{"message":"Unauthorized"}`, unauthorized: true},
+		{name: "redirection", statusCode: http.StatusMultipleChoices, body: "multiple choices"},
+	}
+	for _, tt := range tests {
+		c := NewWithOptions("token", WithDoer(respond(tt.statusCode, tt.body)))
+
+		_, err := c.GetArtifactDetails("app", "build", "artifact")
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) {
+			t.Fatalf("%s: got %v, want an *APIError", tt.name, err)
+		}
+		if apiErr.StatusCode != tt.statusCode || apiErr.Body != tt.body || apiErr.Endpoint != "apps/app/builds/build/artifacts/artifact" {
+			t.Errorf("%s: got %+v", tt.name, apiErr)
+		}
+		if got := errors.Is(err, ErrUnauthorized); got != tt.unauthorized {
+			t.Errorf("%s: errors.Is(ErrUnauthorized) = %t, want %t", tt.name, got, tt.unauthorized)
+		}
+	}
+}
+
+func TestWithDoerDecodeError(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{name: "html page", body: "<html>Bad Gateway</html>"},
+		{name: "truncated", body: `{"data":[{"slug":"app"`},
+		{name: "wrong type", body: `{"data":"app"}`},
+	}
+	for _, tt := range tests {
+		c := NewWithOptions("token", WithDoer(respond(http.StatusOK, tt.body)))
+
+		_, err := c.GetArtifactsForBuild("app", "build")
+		if err == nil {
+			t.Fatalf("%s: expected an error", tt.name)
+		}
+		if !strings.Contains(err.Error(), "failed to decode the response of (apps/app/builds/build/artifacts)") ||
+			!strings.Contains(err.Error(), tt.body) {
+			t.Errorf("%s: got %v", tt.name, err)
+		}
+	}
+}
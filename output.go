@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// exportEnv exports the value as a Bitrise output env var with envman, skipped when envman is not installed
+func exportEnv(key, value string) error {
+	if _, err := exec.LookPath("envman"); err != nil {
+		warnf("envman not found, (%s) is not exported", key)
+		return nil
+	}
+
+	if out, err := exec.Command("envman", "add", "--key", key, "--value", value).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to export (%s): %w, output: %s", key, err, string(out))
+	}
+	return nil
+}
+
+const publicInstallPageURLKey = "ARTEFACT_PUBLIC_INSTALL_PAGE_URL"
+const slugKey = "ARTEFACT_SLUG"
+const typeKey = "ARTEFACT_TYPE"
+const bytesKey = "ARTEFACT_BYTES"
+const durationKey = "ARTEFACT_DOWNLOAD_DURATION_MS"
+const buildNumberKey = "ARTEFACT_BUILD_NUMBER"
+const commitHashKey = "ARTEFACT_COMMIT_HASH"
+
+// exportResults exports the paths of the downloaded files, the slugs and types of their artifacts,
+// the downloaded bytes and duration and their public install page urls
+func exportResults(pathKey string, results []downloadResult) error {
+	if err := exportPaths(pathKey, results); err != nil {
+		return err
+	}
+	if err := exportSlugsAndTypes(results); err != nil {
+		return err
+	}
+	if err := exportTotals(results); err != nil {
+		return err
+	}
+	return exportPublicInstallPageURLs(results)
+}
+
+// exportTotals exports the size of the downloaded files and the duration of their transfers, summed
+// over all the artifacts when several are downloaded
+func exportTotals(results []downloadResult) error {
+	var bytes, durationMs int64
+	for _, result := range results {
+		bytes += result.Bytes
+		durationMs += result.DurationMs
+	}
+
+	if err := exportEnv(bytesKey, strconv.FormatInt(bytes, 10)); err != nil {
+		return err
+	}
+	return exportEnv(durationKey, strconv.FormatInt(durationMs, 10))
+}
+
+// exportBuildInfo exports the newline-separated numbers and commit hashes of the builds of the artifacts
+func exportBuildInfo(builds []Build) error {
+	numbers := make([]string, 0, len(builds))
+	hashes := make([]string, 0, len(builds))
+	for _, build := range builds {
+		infof("build #%d (%s): commit %s", build.BuildNumber, build.Slug, build.CommitHash)
+		numbers = append(numbers, strconv.Itoa(build.BuildNumber))
+		hashes = append(hashes, build.CommitHash)
+	}
+
+	if err := exportEnv(buildNumberKey, strings.Join(numbers, "\n")); err != nil {
+		return err
+	}
+	return exportEnv(commitHashKey, strings.Join(hashes, "\n"))
+}
+
+// exportSlugsAndTypes exports the newline-separated slugs and artifact types of the downloaded artifacts,
+// in the same order as their paths
+func exportSlugsAndTypes(results []downloadResult) error {
+	slugs := make([]string, 0, len(results))
+	types := make([]string, 0, len(results))
+	for _, result := range results {
+		slugs = append(slugs, result.Slug)
+		types = append(types, result.ArtifactType)
+	}
+
+	if err := exportEnv(slugKey, strings.Join(slugs, "\n")); err != nil {
+		return err
+	}
+	return exportEnv(typeKey, strings.Join(types, "\n"))
+}
+
+// exportPublicInstallPageURLs exports the newline-separated public install page urls of the downloaded artifacts
+// having their public page enabled, nothing is exported when none has it
+func exportPublicInstallPageURLs(results []downloadResult) error {
+	var urls []string
+	for _, result := range results {
+		if result.PublicInstallPageURL == "" {
+			infof("%s: public install page unavailable", result.Title)
+			continue
+		}
+		infof("%s: public install page: %s", result.Title, result.PublicInstallPageURL)
+		urls = append(urls, result.PublicInstallPageURL)
+	}
+
+	if len(urls) == 0 {
+		return nil
+	}
+	return exportEnv(publicInstallPageURLKey, strings.Join(urls, "\n"))
+}
+
+// exportPaths exports the absolute paths of the downloaded files, newline-separated
+func exportPaths(key string, results []downloadResult) error {
+	var paths []string
+	for _, result := range results {
+		path, err := filepath.Abs(result.Path)
+		if err != nil {
+			return err
+		}
+		paths = append(paths, path)
+	}
+	return exportEnv(key, strings.Join(paths, "\n"))
+}
+
+// manifest summary of the downloads of a run, written to MANIFEST_FILE
+type manifest struct {
+	GeneratedAt string           `json:"generated_at"`
+	Artifacts   []downloadResult `json:"artifacts"`
+}
+
+// writeManifest writes the JSON manifest of the downloads to path, nothing is written when path is empty
+func writeManifest(path string, results []downloadResult, mode os.FileMode) error {
+	if path == "" {
+		return nil
+	}
+
+	content, err := json.MarshalIndent(manifest{GeneratedAt: time.Now().UTC().Format(time.RFC3339), Artifacts: results}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(content, '\n'), mode); err != nil {
+		return fmt.Errorf("failed to write the manifest: %w", err)
+	}
+	infof("manifest written to (%s)", path)
+	return nil
+}
+
+// printJSON prints the value as indented JSON on stdout
+func printJSON(v interface{}) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(b))
+	return nil
+}
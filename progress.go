@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+const progressInterval = 1 * time.Second
+
+// progressReader prints the progress of the reads, at most once per progressInterval
+type progressReader struct {
+	reader io.Reader
+	name   string
+	// offset byte count already downloaded before the reads, when resuming a download
+	offset int64
+	// total expected byte count, zero when unknown
+	total     int64
+	read      int64
+	start     time.Time
+	lastPrint time.Time
+	// lastRead byte count read at the last print, for the instantaneous rate
+	lastRead int64
+}
+
+func newProgressReader(reader io.Reader, name string, offset, total int64) *progressReader {
+	now := time.Now()
+	return &progressReader{
+		reader:    reader,
+		name:      name,
+		offset:    offset,
+		total:     total,
+		start:     now,
+		lastPrint: now,
+	}
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.reader.Read(b)
+	p.read += int64(n)
+
+	if now := time.Now(); now.Sub(p.lastPrint) >= progressInterval {
+		p.print(now)
+		p.lastPrint = now
+		p.lastRead = p.read
+	}
+	return n, err
+}
+
+func (p *progressReader) print(now time.Time) {
+	downloaded := p.offset + p.read
+	rate := formatRate(bytesPerSecond(p.read-p.lastRead, now.Sub(p.lastPrint)))
+	if p.total <= 0 || p.read <= 0 {
+		infof("%s: [%d byte] downloaded (%s)", p.name, downloaded, rate)
+		return
+	}
+
+	elapsed := now.Sub(p.start)
+	percent := float64(downloaded) * 100 / float64(p.total)
+	eta := time.Duration(float64(elapsed) * float64(p.total-downloaded) / float64(p.read))
+	infof("%s: [%d/%d byte] downloaded (%.1f%%, %s, ETA %s)", p.name, downloaded, p.total, percent, rate, eta.Round(time.Second))
+}
+
+// bytesPerSecond the average rate of the transfer, zero for a zero duration
+func bytesPerSecond(bytes int64, d time.Duration) int64 {
+	if d <= 0 {
+		return 0
+	}
+	return int64(float64(bytes) / d.Seconds())
+}
+
+// formatRate formats the rate in MB/s
+func formatRate(bytesPerSecond int64) string {
+	return fmt.Sprintf("%.2f MB/s", float64(bytesPerSecond)/1e6)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+)
+
+// publicInstallPageTypes artifact types for which Bitrise generates a public install page
+var publicInstallPageTypes = []string{"android-apk", "ios-ipa"}
+
+// PublicDownload fetches an artifact from its public install page url, without any auth token.
+//
+// Bitrise only generates public install pages for the installable artifact types (android-apk and ios-ipa),
+// when the page is enabled on the artifact. Depending on the device asking for it, the page may be served as
+// an HTML install page instead of the file itself, which is reported as an error rather than returned as the
+// artifact content: the API and its expiring download url remain the reliable way to download an artifact.
+// The request goes through the download client, with its timeout, proxy and TLS settings. The caller must close
+// the returned body.
+func (c Client) PublicDownload(publicInstallPageURL string) (io.ReadCloser, error) {
+	return c.PublicDownloadCtx(context.Background(), publicInstallPageURL)
+}
+
+// PublicDownloadCtx is PublicDownload with a cancellable context
+func (c Client) PublicDownloadCtx(ctx context.Context, publicInstallPageURL string) (io.ReadCloser, error) {
+	resp, err := c.openURL(ctx, http.MethodGet, publicInstallPageURL, 0, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= 300 || resp.StatusCode < 200 {
+		responseBodyCloser(resp)
+		return nil, fmt.Errorf("failed to download (%s) with status code (%d)", publicInstallPageURL, resp.StatusCode)
+	}
+
+	if mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type")); err == nil && mediaType == "text/html" {
+		responseBodyCloser(resp)
+		return nil, fmt.Errorf("public install page (%s) serves an HTML page, not a direct download (supported artifact types: %v)", publicInstallPageURL, publicInstallPageTypes)
+	}
+
+	return resp.Body, nil
+}
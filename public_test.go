@@ -0,0 +1,36 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestPublicDownloadUsesClientDoer(t *testing.T) {
+	var requested string
+	doer := doerFunc(func(req *http.Request) (*http.Response, error) {
+		requested = req.URL.String()
+		return &http.Response{StatusCode: http.StatusOK, Header: http.Header{"Content-Type": {"application/vnd.android.package-archive"}}, Body: io.NopCloser(strings.NewReader("apk")), Request: req}, nil
+	})
+	c := NewWithOptions("token", WithDoer(doer))
+
+	body, err := c.PublicDownload("https://app.bitrise.io/artifact/1/p/abc")
+	if err != nil {
+		t.Fatalf("PublicDownload: %v", err)
+	}
+	defer body.Close()
+	if content, _ := io.ReadAll(body); string(content) != "apk" || requested != "https://app.bitrise.io/artifact/1/p/abc" {
+		t.Errorf("got %q from (%s)", content, requested)
+	}
+}
+
+func TestPublicDownloadHTMLPage(t *testing.T) {
+	c := NewWithOptions("token", WithDoer(doerFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Header: http.Header{"Content-Type": {"text/html; charset=utf-8"}}, Body: io.NopCloser(strings.NewReader("<html></html>")), Request: req}, nil
+	})))
+
+	if _, err := c.PublicDownload("https://app.bitrise.io/artifact/1/p/abc"); err == nil || !strings.Contains(err.Error(), "serves an HTML page") {
+		t.Errorf("PublicDownload: got %v, want an HTML page error", err)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// resumeStateSuffix suffix of the state file kept next to the .part file, so that a later run only resumes
+// the partial download when the remote file is unchanged
+const resumeStateSuffix = ".state"
+
+// resumeState what is known of the remote file of a partial download. The expiring download url isn't kept,
+// a fresh one is fetched by every run and a signed url shouldn't be left in the download directory.
+type resumeState struct {
+	Slug string `json:"slug"`
+	// Size expected size of the complete file, zero when unknown
+	Size int64 `json:"size,omitempty"`
+	// Offset number of bytes written to the .part file when the download stopped
+	Offset       int64  `json:"offset"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+// newResumeState returns the state of the download of the artifact served by resp
+func newResumeState(slug string, size int64, resp *http.Response) resumeState {
+	return resumeState{Slug: slug, Size: size, ETag: resp.Header.Get("ETag"), LastModified: resp.Header.Get("Last-Modified")}
+}
+
+// readResumeState returns the state of the partial download, ok is false when there is none or it is corrupt
+func readResumeState(partPath string) (state resumeState, ok bool) {
+	content, err := os.ReadFile(partPath + resumeStateSuffix)
+	if err != nil {
+		return resumeState{}, false
+	}
+	if err := json.Unmarshal(content, &state); err != nil {
+		debugf("ignoring corrupt resume state of (%s): %s", partPath, err)
+		return resumeState{}, false
+	}
+	return state, true
+}
+
+// writeResumeState stores the state of the partial download, failing to do so only costs a fresh download
+func writeResumeState(partPath string, state resumeState, mode os.FileMode) {
+	content, err := json.Marshal(state)
+	if err != nil {
+		return
+	}
+	if err := os.WriteFile(partPath+resumeStateSuffix, content, mode); err != nil {
+		debugf("failed to write the resume state of (%s): %s", partPath, err)
+	}
+}
+
+// removePartFile removes the partial download and its state
+func removePartFile(partPath string) {
+	removeFile(partPath)
+	removeResumeState(partPath)
+}
+
+// removeResumeState removes the state of the partial download, if any
+func removeResumeState(partPath string) {
+	if err := os.Remove(partPath + resumeStateSuffix); err != nil && !os.IsNotExist(err) {
+		warnf("Failed to remove (%s): %+v", partPath+resumeStateSuffix, err)
+	}
+}
+
+// validate returns why the partial download of partSize bytes can't be resumed for the artifact, nil when it can
+func (s resumeState) validate(slug string, size, partSize int64) error {
+	switch {
+	case s.Slug != slug:
+		return fmt.Errorf("it belongs to the artifact (%s)", s.Slug)
+	case s.Size > 0 && size > 0 && s.Size != size:
+		return fmt.Errorf("the size changed from %d to %d", s.Size, size)
+	case partSize < s.Offset:
+		return fmt.Errorf("it is shorter than the %d bytes downloaded", s.Offset)
+	}
+	return nil
+}
+
+// sameContent reports whether resp serves the file of the state, by ETag or else by Last-Modified,
+// true when neither can tell
+func (s resumeState) sameContent(resp *http.Response) bool {
+	if etag := resp.Header.Get("ETag"); s.ETag != "" && etag != "" {
+		return etag == s.ETag
+	}
+	if lastModified := resp.Header.Get("Last-Modified"); s.LastModified != "" && lastModified != "" {
+		return lastModified == s.LastModified
+	}
+	return true
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const resumedContent = "0123456789"
+
+// rangeServer serves the download of its content with its ETag, recording the Range header of each request
+type rangeServer struct {
+	content string
+	etag    string
+	// ignoreRange serves the whole content to the Range requests
+	ignoreRange bool
+	// cutAt closes the connection of the first request once that many bytes are sent
+	cutAt int
+
+	mu     sync.Mutex
+	ranges []string
+}
+
+func (s *rangeServer) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.ranges = append(s.ranges, r.Header.Get("Range"))
+	first := len(s.ranges) == 1
+	s.mu.Unlock()
+
+	w.Header().Set("ETag", s.etag)
+	w.Header().Set("Content-Type", "application/octet-stream")
+	switch {
+	case first && s.cutAt > 0:
+		w.Header().Set("Content-Length", "10")
+		w.Write([]byte(s.content[:s.cutAt]))
+		w.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	case s.ignoreRange:
+		w.Write([]byte(s.content))
+	default:
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(s.content))
+	}
+}
+
+// requestedRanges returns the Range header of each request, empty for the requests of the whole content
+func (s *rangeServer) requestedRanges() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.ranges...)
+}
+
+// writePartFile leaves the partial download of an earlier run, with its state when state is not nil
+func writePartFile(t *testing.T, cfg Config, content string, state *resumeState) {
+	t.Helper()
+	partPath := filepath.Join(cfg.DownloadDir, "app.apk"+partSuffix)
+	if err := os.WriteFile(partPath, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if state != nil {
+		writeResumeState(partPath, *state, 0o644)
+	}
+}
+
+// checkResumed checks the downloaded file is complete and the partial download and its state removed
+func checkResumed(t *testing.T, cfg Config, want string) {
+	t.Helper()
+	path := filepath.Join(cfg.DownloadDir, "app.apk")
+	if content, err := os.ReadFile(path); err != nil || string(content) != want {
+		t.Errorf("downloaded content = %q, %v, want %q", content, err, want)
+	}
+	for _, leftover := range []string{path + partSuffix, path + partSuffix + resumeStateSuffix} {
+		if _, err := os.Stat(leftover); !os.IsNotExist(err) {
+			t.Errorf("(%s) left after the download: %v", leftover, err)
+		}
+	}
+}
+
+func TestResumePartFile(t *testing.T) {
+	api := newMockAPI(t, map[string]string{"app.apk": resumedContent})
+	server := &rangeServer{content: resumedContent, etag: `"v1"`}
+	api.download = server.serve
+	cfg := testConfig(t, api, map[string]string{"ARTIFACT_NAME": "app.apk"})
+	writePartFile(t, cfg, "01234", &resumeState{Slug: "app.apk", Size: 10, Offset: 5, ETag: `"v1"`})
+
+	if err := runConfig(t, cfg); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if got := server.requestedRanges(); len(got) != 1 || got[0] != "bytes=5-" {
+		t.Errorf("requested ranges = %q, want [bytes=5-]", got)
+	}
+	checkResumed(t, cfg, resumedContent)
+}
+
+func TestResumeDiscardsStaleState(t *testing.T) {
+	tests := []struct {
+		name   string
+		state  resumeState
+		ranges []string
+	}{
+		{
+			name:  "etag changed",
+			state: resumeState{Slug: "app.apk", Size: 10, Offset: 5, ETag: `"v0"`},
+			// the 206 of the new version is dropped for the whole content
+			ranges: []string{"bytes=5-", ""},
+		},
+		{
+			name:   "size changed",
+			state:  resumeState{Slug: "app.apk", Size: 20, Offset: 5, ETag: `"v1"`},
+			ranges: []string{""},
+		},
+		{
+			name:   "other artifact",
+			state:  resumeState{Slug: "other.apk", Size: 10, Offset: 5, ETag: `"v1"`},
+			ranges: []string{""},
+		},
+	}
+	for _, tt := range tests {
+		api := newMockAPI(t, map[string]string{"app.apk": resumedContent})
+		server := &rangeServer{content: resumedContent, etag: `"v1"`}
+		api.download = server.serve
+		cfg := testConfig(t, api, map[string]string{"ARTIFACT_NAME": "app.apk"})
+		// the part of the former version differs from the new content
+		writePartFile(t, cfg, "abcde", &tt.state)
+
+		if err := runConfig(t, cfg); err != nil {
+			t.Fatalf("%s: run: %v", tt.name, err)
+		}
+		if got := server.requestedRanges(); strings.Join(got, ",") != strings.Join(tt.ranges, ",") {
+			t.Errorf("%s: requested ranges = %q, want %q", tt.name, got, tt.ranges)
+		}
+		checkResumed(t, cfg, resumedContent)
+	}
+}
+
+func TestResumeRangeIgnored(t *testing.T) {
+	api := newMockAPI(t, map[string]string{"app.apk": resumedContent})
+	server := &rangeServer{content: resumedContent, etag: `"v1"`, ignoreRange: true}
+	api.download = server.serve
+	cfg := testConfig(t, api, map[string]string{"ARTIFACT_NAME": "app.apk"})
+	// a part without state is resumed unchecked
+	writePartFile(t, cfg, "abcde", nil)
+
+	if err := runConfig(t, cfg); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if got := server.requestedRanges(); len(got) != 1 || got[0] != "bytes=5-" {
+		t.Errorf("requested ranges = %q, want [bytes=5-]", got)
+	}
+	// the 200 restarts the download instead of appending the whole content
+	checkResumed(t, cfg, resumedContent)
+}
+
+func TestResumeMidStream(t *testing.T) {
+	api := newMockAPI(t, map[string]string{"app.apk": resumedContent})
+	server := &rangeServer{content: resumedContent, etag: `"v1"`, cutAt: 4}
+	api.download = server.serve
+	cfg := testConfig(t, api, map[string]string{"ARTIFACT_NAME": "app.apk", "DOWNLOAD_MAX_RETRIES": "0"})
+
+	if err := runConfig(t, cfg); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if got := server.requestedRanges(); len(got) != 2 || got[0] != "" || got[1] != "bytes=4-" {
+		t.Errorf("requested ranges = %q, want [ bytes=4-]", got)
+	}
+	checkResumed(t, cfg, resumedContent)
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// slugPattern characters of any slug, permissive enough for future slug formats
+var slugPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// strictSlugPattern the known Bitrise slug formats: 16 or 32 hex digits, or a UUID
+var strictSlugPattern = regexp.MustCompile(`^([0-9a-f]{16}|[0-9a-f]{32}|[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12})$`)
+
+// validateSlug checks the slug format before it is used in an API call, against the known Bitrise slug
+// formats when strict, kind names the slug in the error, like "app"
+func validateSlug(kind, slug string, strict bool) error {
+	if slug == "" {
+		return fmt.Errorf("invalid %s slug format: empty", kind)
+	}
+	if !slugPattern.MatchString(slug) {
+		return fmt.Errorf("invalid %s slug format (%s): expected letters, digits, - and _ only", kind, slug)
+	}
+	if strict && !strictSlugPattern.MatchString(slug) {
+		return fmt.Errorf("invalid %s slug format (%s): expected 16 or 32 lowercase hex digits, or a UUID", kind, slug)
+	}
+	return nil
+}
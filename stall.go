@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// defaultStallTimeout window of the stall detection when MIN_DOWNLOAD_BYTES_PER_SEC is set without STALL_TIMEOUT_SEC
+const defaultStallTimeout = 30 * time.Second
+
+// maxStallCheckInterval interval of the throughput checks, shorter for the short windows
+const maxStallCheckInterval = 1 * time.Second
+
+var errDownloadStalled = errors.New("download stalled")
+
+// stallWatch cancels a download whose throughput stays below minBytesPerSec over a sliding window of timeout,
+// turning a download trickling along into a prompt, retryable failure
+type stallWatch struct {
+	minBytesPerSec int64
+	timeout        time.Duration
+	read           atomic.Int64
+}
+
+// stallReader counts the bytes read for the stall watch
+type stallReader struct {
+	reader io.Reader
+	watch  *stallWatch
+}
+
+func (r stallReader) Read(b []byte) (int, error) {
+	n, err := r.reader.Read(b)
+	r.watch.read.Add(int64(n))
+	return n, err
+}
+
+// startStallWatch returns ctx cancelled by a stall watch when minBytesPerSec is set, and the watch, nil otherwise.
+// The requests must be sent with the returned ctx, so a stall interrupts a blocked read of the body. stop ends the watch.
+func (d downloader) startStallWatch(ctx context.Context) (watchCtx context.Context, watch *stallWatch, stop func()) {
+	if d.minBytesPerSec <= 0 {
+		return ctx, nil, func() {}
+	}
+	watch = &stallWatch{minBytesPerSec: d.minBytesPerSec, timeout: d.stallTimeout}
+	watchCtx, cancel := context.WithCancelCause(ctx)
+	go watch.run(watchCtx, cancel)
+	return watchCtx, watch, func() { cancel(nil) }
+}
+
+// stallCause returns the stall of the download when the stall watch cancelled ctx, err otherwise
+func stallCause(ctx context.Context, fileName string, err error) error {
+	if cause := context.Cause(ctx); errors.Is(cause, errDownloadStalled) {
+		return fmt.Errorf("failed to download (%s): %w", fileName, cause)
+	}
+	return err
+}
+
+// wrap returns the reader counting its reads for the watch
+func (w *stallWatch) wrap(reader io.Reader) io.Reader {
+	return stallReader{reader: reader, watch: w}
+}
+
+// run checks the throughput until ctx is done, cancelling it with an errDownloadStalled cause
+// when less than minBytesPerSec were read on average over the last timeout
+func (w *stallWatch) run(ctx context.Context, cancel context.CancelCauseFunc) {
+	interval := min(w.timeout/4, maxStallCheckInterval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	type sample struct {
+		at   time.Time
+		read int64
+	}
+	samples := []sample{{at: time.Now()}}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			current := sample{at: now, read: w.read.Load()}
+			samples = append(samples, current)
+			// keep the oldest sample of the window
+			for len(samples) > 1 && now.Sub(samples[1].at) >= w.timeout {
+				samples = samples[1:]
+			}
+
+			oldest := samples[0]
+			if elapsed := now.Sub(oldest.at); elapsed >= w.timeout && bytesPerSecond(current.read-oldest.read, elapsed) < w.minBytesPerSec {
+				cancel(fmt.Errorf("%w: below [%d byte/s] for %s", errDownloadStalled, w.minBytesPerSec, w.timeout))
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestDownloadStalled(t *testing.T) {
+	api := newMockAPI(t, map[string]string{"app.apk": "content"})
+	// a few bytes then nothing, the read of the body blocks until the request is cancelled
+	api.download = func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", strconv.Itoa(1<<20))
+		w.Write([]byte("trickle"))
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}
+	cfg := testConfig(t, api, map[string]string{
+		"ARTIFACT_SLUG":              "app.apk",
+		"MIN_DOWNLOAD_BYTES_PER_SEC": "1000",
+		"STALL_TIMEOUT_SEC":          "1",
+		"DOWNLOAD_MAX_RETRIES":       "0",
+	})
+
+	start := time.Now()
+	err := runConfig(t, cfg)
+	if !errors.Is(err, errDownloadStalled) {
+		t.Fatalf("run: got %v, want errDownloadStalled", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("stall detected after %s, want about 1s", elapsed)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// maxThrottledChunk largest chunk read or written at once through a rate limiter, keeping the rate smooth
+const maxThrottledChunk = 32 * 1024
+
+// rateLimiter token bucket limiting the bytes per second transferred by the downloads sharing it.
+// The tokens can go negative: a transfer takes its tokens at once, then waits for the bucket to refill.
+type rateLimiter struct {
+	bytesPerSec float64
+	// burst maximum tokens, a tenth of a second of transfer
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(bytesPerSec int64) *rateLimiter {
+	burst := max(float64(bytesPerSec)/10, 1)
+	return &rateLimiter{bytesPerSec: float64(bytesPerSec), burst: burst, tokens: burst, last: time.Now()}
+}
+
+// chunk returns the size of the next transfer of up to n bytes
+func (l *rateLimiter) chunk(n int) int {
+	return max(min(n, int(l.burst), maxThrottledChunk), 1)
+}
+
+// wait takes n tokens, waiting until the bucket holds them again or ctx is done
+func (l *rateLimiter) wait(ctx context.Context, n int) error {
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.bytesPerSec)
+	l.last = now
+	l.tokens -= float64(n)
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.bytesPerSec * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	if delay == 0 {
+		return nil
+	}
+	return sleepCtx(ctx, delay)
+}
+
+// throttledReader reads through the rate limiter
+type throttledReader struct {
+	ctx     context.Context
+	reader  io.Reader
+	limiter *rateLimiter
+}
+
+func (r throttledReader) Read(b []byte) (int, error) {
+	if len(b) == 0 {
+		return r.reader.Read(b)
+	}
+	n, err := r.reader.Read(b[:r.limiter.chunk(len(b))])
+	if n > 0 {
+		if waitErr := r.limiter.wait(r.ctx, n); waitErr != nil && err == nil {
+			err = waitErr
+		}
+	}
+	return n, err
+}
+
+// throttledWriter writes through the rate limiter
+type throttledWriter struct {
+	ctx     context.Context
+	writer  io.Writer
+	limiter *rateLimiter
+}
+
+func (w throttledWriter) Write(b []byte) (int, error) {
+	var written int
+	for written < len(b) {
+		chunk := b[written : written+w.limiter.chunk(len(b)-written)]
+		if err := w.limiter.wait(w.ctx, len(chunk)); err != nil {
+			return written, err
+		}
+		n, err := w.writer.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
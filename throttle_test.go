@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestThrottledTransfers(t *testing.T) {
+	const bytesPerSec, size = 10000, 5000
+	content := strings.Repeat("x", size)
+	transfers := map[string]func(ctx context.Context, limiter *rateLimiter) (int64, error){
+		"reader": func(ctx context.Context, limiter *rateLimiter) (int64, error) {
+			return io.Copy(io.Discard, throttledReader{ctx: ctx, reader: strings.NewReader(content), limiter: limiter})
+		},
+		"writer": func(ctx context.Context, limiter *rateLimiter) (int64, error) {
+			n, err := throttledWriter{ctx: ctx, writer: &bytes.Buffer{}, limiter: limiter}.Write([]byte(content))
+			return int64(n), err
+		},
+	}
+	for name, transfer := range transfers {
+		start := time.Now()
+		n, err := transfer(context.Background(), newRateLimiter(bytesPerSec))
+		elapsed := time.Since(start)
+		if err != nil || n != size {
+			t.Fatalf("%s: transferred %d, %v", name, n, err)
+		}
+		// the first tenth of a second of transfer is the burst
+		if want := 400 * time.Millisecond; elapsed < want || elapsed > 5*want {
+			t.Errorf("%s: %d bytes at %d byte/s took %s, want about %s", name, size, bytesPerSec, elapsed, want)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		_, err = transfer(ctx, newRateLimiter(bytesPerSec))
+		cancel()
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("%s: cancelled transfer got %v, want context.DeadlineExceeded", name, err)
+		}
+	}
+}
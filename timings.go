@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// phases of the timings breakdown, an API call is counted both as api and as its list or details phase
+const (
+	phaseAPI      = "api"
+	phaseList     = "list"
+	phaseDetails  = "details"
+	phaseDownload = "download"
+)
+
+var timingPhases = []string{phaseAPI, phaseList, phaseDetails, phaseDownload}
+
+// phaseTimings cumulated duration and count of each phase, safe for concurrent use
+type phaseTimings struct {
+	mu        sync.Mutex
+	durations map[string]time.Duration
+	counts    map[string]int
+}
+
+// timings of the API calls and downloads of the run, printed with TIMINGS or the debug log level
+var timings = &phaseTimings{durations: map[string]time.Duration{}, counts: map[string]int{}}
+
+// track adds the time elapsed since start to the phase, meant to be deferred
+func (t *phaseTimings) track(phase string, start time.Time) {
+	elapsed := time.Since(start)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.durations[phase] += elapsed
+	t.counts[phase]++
+}
+
+// print logs the breakdown of the phases, parallel downloads can add up to more than the total
+func (t *phaseTimings) print(total time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	parts := make([]string, 0, len(timingPhases)+1)
+	for _, phase := range timingPhases {
+		parts = append(parts, fmt.Sprintf("%s %dms (%d)", phase, t.durations[phase].Milliseconds(), t.counts[phase]))
+	}
+	parts = append(parts, fmt.Sprintf("total %dms", total.Milliseconds()))
+	infof("timings: %s", strings.Join(parts, ", "))
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"syscall"
+)
+
+// newTransport returns a transport going through the proxy when set, or the proxy of the HTTP_PROXY,
+// HTTPS_PROXY and NO_PROXY env vars otherwise, with the TLS config when set
+func newTransport(proxy *url.URL, tlsConfig *tls.Config) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyFromEnvironment
+	if proxy != nil {
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+	if tlsConfig != nil {
+		transport.TLSClientConfig = tlsConfig
+	}
+	return transport
+}
+
+// transport returns the transport going through the ProxyURL of the config, whose credentials, if any,
+// authenticate to the proxy, trusting its CA certificates and sized by its connection pool settings.
+// The default of 2 idle connections per host can bottleneck the concurrent downloads from the same storage host.
+func (cfg Config) transport() (*http.Transport, error) {
+	tlsConfig, err := newTLSConfig(cfg.CACertFile, cfg.InsecureSkipTLSVerify)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.ProxyURL != nil {
+		infof("using the proxy %s", redactURL(cfg.ProxyURL.String()))
+	}
+	transport := newTransport(cfg.ProxyURL, tlsConfig)
+	transport.MaxIdleConns = cfg.MaxIdleConns
+	transport.MaxIdleConnsPerHost = cfg.MaxIdleConnsPerHost
+	transport.IdleConnTimeout = cfg.IdleConnTimeout
+	return transport, nil
+}
+
+// newTLSConfig returns the TLS config trusting the caCertFile certificates on top of the system ones,
+// and skipping the certificate verification when insecure, nil when neither is set
+func newTLSConfig(caCertFile string, insecure bool) (*tls.Config, error) {
+	if caCertFile == "" && !insecure {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caCertFile != "" {
+		pool, err := loadCertPool(caCertFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if insecure {
+		warnf("INSECURE_SKIP_TLS_VERIFY is enabled, TLS certificates are NOT verified, the connections can be intercepted")
+		tlsConfig.InsecureSkipVerify = true
+	}
+	return tlsConfig, nil
+}
+
+// loadCertPool returns the system certificate pool with the certificates of the PEM bundle added
+func loadCertPool(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the CA certificate file (%s): %w", path, err)
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("CA certificate file (%s) holds no valid PEM certificate", path)
+	}
+	return pool, nil
+}
+
+// setTransport makes both the API and the download requests go through the transport
+func (c *Client) setTransport(transport http.RoundTripper) {
+	c.httpClient.Transport = transport
+	c.downloadClient.Transport = transport
+}
+
+// friendlyNetworkError explains the DNS, connection and TLS failures to reach the host, which the raw
+// Go errors leave obscure, the error is returned unchanged otherwise
+func friendlyNetworkError(host string, err error) error {
+	var reason string
+	var dnsErr *net.DNSError
+	var certErr *tls.CertificateVerificationError
+	var unknownAuthorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var recordErr tls.RecordHeaderError
+	switch {
+	case errors.As(err, &dnsErr):
+		reason = "DNS lookup failed"
+	case errors.Is(err, syscall.ECONNREFUSED):
+		reason = "connection refused"
+	case errors.Is(err, syscall.ENETUNREACH) || errors.Is(err, syscall.EHOSTUNREACH):
+		reason = "network unreachable"
+	case errors.As(err, &certErr) || errors.As(err, &unknownAuthorityErr) || errors.As(err, &hostnameErr):
+		reason = "TLS certificate not trusted, see CA_CERT_FILE"
+	case errors.As(err, &recordErr):
+		reason = "TLS handshake failed"
+	default:
+		return err
+	}
+	return fmt.Errorf("could not reach %s (%s), check the network and proxy configuration: %w", host, reason, err)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// closedAddr returns an address nothing listens on anymore, refusing the connections
+func closedAddr(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	if err := listener.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return addr
+}
+
+func TestFriendlyNetworkError(t *testing.T) {
+	unreachable := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return nil, &net.OpError{Op: "dial", Net: network, Err: os.NewSyscallError("connect", syscall.ENETUNREACH)}
+	}
+	tests := []struct {
+		name   string
+		dial   func(ctx context.Context, network, addr string) (net.Conn, error)
+		reason string
+	}{
+		{name: "refused", dial: (&net.Dialer{}).DialContext, reason: "connection refused"},
+		{name: "unreachable", dial: unreachable, reason: "network unreachable"},
+	}
+	for _, tt := range tests {
+		addr := closedAddr(t)
+		httpClient := &http.Client{Transport: &http.Transport{DialContext: tt.dial}}
+		c := NewWithOptions("token", WithBaseURL("http://"+addr), WithHTTPClient(httpClient), WithMaxRetries(0))
+
+		_, err := c.GetArtifactsForBuild("app", "build")
+		if err == nil {
+			t.Fatalf("%s: expected an error", tt.name)
+		}
+		if want := "could not reach " + addr + " (" + tt.reason + ")"; !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: error %q does not contain %q", tt.name, err, want)
+		}
+		var opErr *net.OpError
+		if !errors.As(err, &opErr) {
+			t.Errorf("%s: error %q does not wrap a *net.OpError", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// downloadURLsConcurrency maximum number of parallel artifact details requests of GetDownloadURLs
+const downloadURLsConcurrency = 4
+
+// DownloadURL signed download url of an artifact
+type DownloadURL struct {
+	Slug  string `json:"slug"`
+	Title string `json:"title"`
+	URL   string `json:"url"`
+	// ExpiresAt RFC3339 expiry time of the url, empty when the url doesn't tell
+	ExpiresAt string `json:"expires_at,omitempty"`
+}
+
+// GetDownloadURLs returns the expiring download url of every artifact of the build by title, to hand out
+// the links rather than the content. The urls are short-lived. The details of up to downloadURLsConcurrency
+// artifacts are fetched in parallel, the first error cancels the other requests and is returned.
+func (c Client) GetDownloadURLs(appSlug, buildSlug string) (map[string]string, error) {
+	return c.GetDownloadURLsCtx(context.Background(), appSlug, buildSlug)
+}
+
+// GetDownloadURLsCtx is GetDownloadURLs with a cancellable context
+func (c Client) GetDownloadURLsCtx(ctx context.Context, appSlug, buildSlug string) (map[string]string, error) {
+	artifacts, err := c.GetArtifactsForBuildCtx(ctx, appSlug, buildSlug)
+	if err != nil {
+		return nil, err
+	}
+
+	downloadURLs, err := c.getDownloadURLs(ctx, appSlug, buildSlug, artifacts.Data)
+	if err != nil {
+		return nil, err
+	}
+	urls := make(map[string]string, len(downloadURLs))
+	for _, downloadURL := range downloadURLs {
+		if _, exists := urls[downloadURL.Title]; exists {
+			warnf("Several artifacts are named (%s), only the url of (%s) is kept", downloadURL.Title, downloadURL.Slug)
+		}
+		urls[downloadURL.Title] = downloadURL.URL
+	}
+	return urls, nil
+}
+
+// getDownloadURLs returns the expiring download urls of the artifacts, in the same order
+func (c Client) getDownloadURLs(ctx context.Context, appSlug, buildSlug string, artifacts []ArtifactListItem) ([]DownloadURL, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	results := make([]DownloadURL, len(artifacts))
+	semaphore := make(chan struct{}, downloadURLsConcurrency)
+	for i, artifact := range artifacts {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(i int, artifact ArtifactListItem) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+
+			details, err := c.GetArtifactDetailsCtx(ctx, appSlug, buildSlug, artifact.Slug)
+			if err != nil {
+				once.Do(func() {
+					firstErr = fmt.Errorf("failed to get the download url of (%s): %w", artifact.Title, err)
+					cancel()
+				})
+				return
+			}
+			results[i] = DownloadURL{Slug: details.Data.Slug, Title: details.Data.Title, URL: details.Data.ExpiringDownloadURL}
+			if !details.ExpiresAt.IsZero() {
+				results[i].ExpiresAt = details.ExpiresAt.UTC().Format(time.RFC3339)
+			}
+		}(i, artifact)
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return results, nil
+}
+
+// printDownloadURLs prints the expiring download urls of the artifacts as JSON, with a warning about their short life
+func printDownloadURLs(ctx context.Context, c Client, appSlug, buildSlug string, artifacts []ArtifactListItem) error {
+	downloadURLs, err := c.getDownloadURLs(ctx, appSlug, buildSlug, artifacts)
+	if err != nil {
+		return err
+	}
+
+	var earliest string
+	for _, downloadURL := range downloadURLs {
+		if downloadURL.ExpiresAt != "" && (earliest == "" || downloadURL.ExpiresAt < earliest) {
+			earliest = downloadURL.ExpiresAt
+		}
+	}
+	if earliest != "" {
+		warnf("The download urls are signed and short-lived, the first one expires at %s", earliest)
+	} else {
+		warnf("The download urls are signed and short-lived")
+	}
+	return printJSON(downloadURLs)
+}
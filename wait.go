@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// defaultWaitTimeout how long WAIT_FOR_ARTIFACTS waits for the artifacts without WAIT_TIMEOUT_SEC
+const defaultWaitTimeout = 5 * time.Minute
+
+// defaultWaitPollInterval delay between two listings of the waited for artifacts
+const defaultWaitPollInterval = 10 * time.Second
+
+// WaitForArtifacts polls the artifacts of the build until it has at least one, or the timeout elapses,
+// in which case an ErrNoArtifacts error is returned. It handles the race between the end of the build
+// uploading its artifacts and this step listing them.
+func (c Client) WaitForArtifacts(appSlug, buildSlug string, timeout time.Duration) (Artifacts, error) {
+	return c.WaitForArtifactsCtx(context.Background(), appSlug, buildSlug, timeout)
+}
+
+// WaitForArtifactsCtx is WaitForArtifacts with a cancellable context
+func (c Client) WaitForArtifactsCtx(ctx context.Context, appSlug, buildSlug string, timeout time.Duration) (Artifacts, error) {
+	hasArtifacts := func(artifacts Artifacts) bool { return len(artifacts.Data) > 0 }
+	artifacts, err := c.waitForArtifacts(ctx, appSlug, buildSlug, "", timeout, defaultWaitPollInterval, hasArtifacts)
+	if err != nil {
+		return artifacts, err
+	}
+	if !hasArtifacts(artifacts) {
+		return artifacts, sentinelError{
+			message:  fmt.Sprintf("build (%s) has no artifacts after waiting %s", buildSlug, timeout),
+			sentinel: ErrNoArtifacts,
+		}
+	}
+	return artifacts, nil
+}
+
+// waitForArtifacts lists the artifacts of the build having the artifact type every interval until ready
+// accepts them or the timeout elapses, the last listing is returned either way. The listing cache is
+// bypassed, it could hold the listing of a build still uploading its artifacts.
+func (c Client) waitForArtifacts(ctx context.Context, appSlug, buildSlug, artifactType string, timeout, interval time.Duration, ready func(Artifacts) bool) (Artifacts, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		artifacts, err := c.getAllArtifacts(ctx, appSlug, buildSlug, artifactType)
+		if err != nil {
+			return Artifacts{}, err
+		}
+		if artifactType != "" {
+			artifacts.Data = filterByType(artifacts.Data, artifactType)
+		}
+		if ready(artifacts) {
+			return artifacts, nil
+		}
+
+		if time.Until(deadline) < interval {
+			warnf("Artifacts of the build (%s) still not ready after waiting %s", buildSlug, timeout)
+			return artifacts, nil
+		}
+		infof("waiting for the artifacts of the build (%s), %d listed, next check in %s", buildSlug, len(artifacts.Data), interval)
+		if err := sleepCtx(ctx, interval); err != nil {
+			return artifacts, err
+		}
+	}
+}